@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// envArgs returns the default arguments for the given subcommand from the
+// environment variables named by EnvArgsPrefix. The arguments for all
+// subcommands come before the ones for the given subcommand.
+func (c *CLI) envArgs(sub string) ([]string, error) {
+	names := []string{c.EnvArgsPrefix + "_CLI_ARGS"}
+	if sub != "" {
+		names = append(names, names[0]+"_"+strings.NewReplacer(" ", "_", "-", "_").Replace(sub))
+	}
+
+	var result []string
+	for _, name := range names {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+
+		args, err := splitArgs(v, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", name, err)
+		}
+
+		result = append(result, args...)
+	}
+
+	return result, nil
+}
+
+// maxResponseFileDepth is the maximum depth of response files that include
+// other response files.
+const maxResponseFileDepth = 10
+
+// expandResponseFiles replaces every argument of the form "@file" with the
+// arguments read from that file, recursively. An argument of the form
+// "@@arg" is replaced by the literal argument "@arg". Arguments after "--"
+// are left alone.
+func expandResponseFiles(args []string, depth int) ([]string, error) {
+	result := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			result = append(result, args[i:]...)
+			break
+		}
+
+		if strings.HasPrefix(arg, "@@") {
+			result = append(result, arg[1:])
+			continue
+		}
+
+		if len(arg) < 2 || arg[0] != '@' {
+			result = append(result, arg)
+			continue
+		}
+
+		if depth >= maxResponseFileDepth {
+			return nil, fmt.Errorf(
+				"response file %s: response files are nested more than %d levels deep",
+				arg[1:], maxResponseFileDepth)
+		}
+
+		data, err := ioutil.ReadFile(arg[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response file: %s", err)
+		}
+
+		fileArgs, err := splitArgs(string(data), true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response file %s: %s", arg[1:], err)
+		}
+
+		fileArgs, err = expandResponseFiles(fileArgs, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, fileArgs...)
+	}
+
+	return result, nil
+}
+
+// splitArgs splits s into arguments using shell-like quoting rules.
+// Arguments are separated by whitespace. Single quotes preserve everything
+// up to the closing quote. Double quotes do as well, except that a
+// backslash escapes a '"' or '\' following it. Outside of quotes, a
+// backslash escapes any character following it. If comments is true, a
+// '#' at the start of an argument starts a comment that runs until the
+// end of the line.
+func splitArgs(s string, comments bool) ([]string, error) {
+	var result []string
+	var buf strings.Builder
+	var inWord, inSingle, inDouble, escaped bool
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			buf.WriteRune(r)
+			escaped = false
+
+		case inSingle:
+			if r == '\'' {
+				inSingle = false
+			} else {
+				buf.WriteRune(r)
+			}
+
+		case inDouble:
+			switch {
+			case r == '"':
+				inDouble = false
+			case r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				buf.WriteRune(runes[i+1])
+				i++
+			default:
+				buf.WriteRune(r)
+			}
+
+		case r == '#' && comments && !inWord:
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+
+		case r == '\\':
+			escaped = true
+			inWord = true
+
+		case r == '\'':
+			inSingle = true
+			inWord = true
+
+		case r == '"':
+			inDouble = true
+			inWord = true
+
+		case unicode.IsSpace(r):
+			if inWord {
+				result = append(result, buf.String())
+				buf.Reset()
+				inWord = false
+			}
+
+		default:
+			buf.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if inSingle || inDouble {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("unterminated escape at end of input")
+	}
+
+	if inWord {
+		result = append(result, buf.String())
+	}
+
+	return result, nil
+}
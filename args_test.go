@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected []string
+		Err      bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"foo", []string{"foo"}, false},
+		{"  foo   bar\tbaz\n", []string{"foo", "bar", "baz"}, false},
+		{`-var 'a=b c'`, []string{"-var", "a=b c"}, false},
+		{`-var "a=b c"`, []string{"-var", "a=b c"}, false},
+		{`a\ b`, []string{"a b"}, false},
+		{`""`, []string{""}, false},
+		{`'it''s'`, []string{"its"}, false},
+		{`"it's"`, []string{"it's"}, false},
+		{`"say \"hi\""`, []string{`say "hi"`}, false},
+		{`"C:\dir"`, []string{`C:\dir`}, false},
+		{`'C:\dir'`, []string{`C:\dir`}, false},
+		{`foo"bar baz"`, []string{"foobar baz"}, false},
+		{`"foo`, nil, true},
+		{`'foo`, nil, true},
+		{`foo\`, nil, true},
+	}
+
+	for _, tc := range cases {
+		actual, err := splitArgs(tc.Input, false)
+		if (err != nil) != tc.Err {
+			t.Errorf("%q: err: %v", tc.Input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Errorf("%q: expected %#v, got %#v", tc.Input, tc.Expected, actual)
+		}
+	}
+}
+
+func TestSplitArgs_comments(t *testing.T) {
+	input := `# Variables for the plan
+-var 'a=b # c' # trailing
+-var=d#e
+  # indented
+"#f"`
+
+	actual, err := splitArgs(input, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"-var", "a=b # c", "-var=d#e", "#f"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestExpandResponseFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"args.txt":   "-a 'b c' # comment\n@" + filepath.Join(dir, "nested.txt") + "\n@@d",
+		"nested.txt": "-e\n-f",
+		"loop.txt":   "@" + filepath.Join(dir, "loop.txt"),
+		"bad.txt":    "'unterminated",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	cases := []struct {
+		Args     []string
+		Expected []string
+		Err      string
+	}{
+		{nil, []string{}, ""},
+		{[]string{"foo", "@"}, []string{"foo", "@"}, ""},
+		{
+			[]string{"foo", "@" + filepath.Join(dir, "args.txt"), "-g"},
+			[]string{"foo", "-a", "b c", "-e", "-f", "@d", "-g"},
+			"",
+		},
+		{[]string{"foo", "@@bar"}, []string{"foo", "@bar"}, ""},
+		{
+			[]string{"foo", "--", "@" + filepath.Join(dir, "args.txt")},
+			[]string{"foo", "--", "@" + filepath.Join(dir, "args.txt")},
+			"",
+		},
+		{[]string{"@" + filepath.Join(dir, "loop.txt")}, nil, "nested more than 10 levels"},
+		{[]string{"@" + filepath.Join(dir, "missing.txt")}, nil, "failed to read response file"},
+		{[]string{"@" + filepath.Join(dir, "bad.txt")}, nil, "unterminated quote"},
+	}
+
+	for _, tc := range cases {
+		actual, err := expandResponseFiles(tc.Args, 0)
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Errorf("%#v: expected error %q, got %v", tc.Args, tc.Err, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%#v: err: %s", tc.Args, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Errorf("%#v: expected %#v, got %#v", tc.Args, tc.Expected, actual)
+		}
+	}
+}
+
+func TestCLIRun_responseFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("bar -var 'a=b'\n")
+	f.Close()
+
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo", "@" + f.Name(), "-x"},
+		Commands: map[string]CommandFactory{
+			"foo":     func() (Command, error) { return new(MockCommand), nil },
+			"foo bar": func() (Command, error) { return command, nil },
+		},
+		ResponseFiles: true,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"-var", "a=b", "-x"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_responseFilesInvalid(t *testing.T) {
+	buf := new(bytes.Buffer)
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo", "@does-not-exist"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) { return command, nil },
+		},
+		ResponseFiles: true,
+		ErrorWriter:   buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatalf("run should not be called")
+	}
+
+	if !strings.HasPrefix(buf.String(), "Error: failed to read response file") {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestCLIRun_envArgs(t *testing.T) {
+	testCases := []struct {
+		args    []string
+		env     map[string]string
+		runArgs []string
+	}{
+		{
+			[]string{"foo", "-a"},
+			nil,
+			[]string{"-a"},
+		},
+		{
+			[]string{"foo", "-a"},
+			map[string]string{"APP_CLI_ARGS": "-b 'c d'"},
+			[]string{"-b", "c d", "-a"},
+		},
+		{
+			[]string{"foo", "-a"},
+			map[string]string{"APP_CLI_ARGS": "-b", "APP_CLI_ARGS_foo": "-c"},
+			[]string{"-b", "-c", "-a"},
+		},
+		{
+			[]string{"foo", "-a"},
+			map[string]string{"APP_CLI_ARGS_foo_bar": "-c"},
+			[]string{"-a"},
+		},
+		{
+			[]string{"foo", "bar", "-a"},
+			map[string]string{"APP_CLI_ARGS_foo_bar": "-c"},
+			[]string{"-c", "-a"},
+		},
+		{
+			[]string{"foo-baz"},
+			map[string]string{"APP_CLI_ARGS_foo_baz": "-c"},
+			[]string{"-c"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		for k, v := range testCase.env {
+			os.Setenv(k, v)
+		}
+
+		command := new(MockCommand)
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"foo":     func() (Command, error) { return command, nil },
+				"foo bar": func() (Command, error) { return command, nil },
+				"foo-baz": func() (Command, error) { return command, nil },
+			},
+			EnvArgsPrefix: "APP",
+		}
+
+		_, err := cli.Run()
+		for k := range testCase.env {
+			os.Unsetenv(k)
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !reflect.DeepEqual(command.RunArgs, testCase.runArgs) {
+			t.Errorf("Args: %#v. Env: %#v. Bad args: %#v",
+				testCase.args, testCase.env, command.RunArgs)
+		}
+	}
+}
+
+func TestCLIRun_envArgsDefault(t *testing.T) {
+	os.Setenv("APP_CLI_ARGS", "-b")
+	defer os.Unsetenv("APP_CLI_ARGS")
+
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"-a"},
+		Commands: map[string]CommandFactory{
+			"": func() (Command, error) { return command, nil },
+		},
+		EnvArgsPrefix: "APP",
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"-b", "-a"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_envArgsInvalid(t *testing.T) {
+	os.Setenv("APP_CLI_ARGS_foo", `-b "c`)
+	defer os.Unsetenv("APP_CLI_ARGS_foo")
+
+	buf := new(bytes.Buffer)
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) { return command, nil },
+		},
+		EnvArgsPrefix: "APP",
+		ErrorWriter:   buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatalf("run should not be called")
+	}
+
+	if expected := "Error: failed to parse APP_CLI_ARGS_foo: unterminated quote\n"; buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
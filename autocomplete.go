@@ -1,6 +1,11 @@
 package cli
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
 	"github.com/posener/complete/cmd/install"
 )
 
@@ -41,3 +46,161 @@ func (i *mockAutocompleteInstaller) Uninstall(cmd string) error {
 	i.UninstallCalled = true
 	return nil
 }
+
+// autocompleteShells are the shells that autocompleteScript supports.
+var autocompleteShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// autocompleteScript returns the script that sets up autocompletion of the
+// command with the given name for the shell. The zsh and fish scripts
+// complete with the hidden "__complete" command, so that they show the
+// descriptions of the candidates and follow the CompletionDirective. The
+// bash and PowerShell scripts run the command with COMP_LINE set, which
+// is the protocol that the complete library uses.
+func autocompleteScript(shell, cmd string) (string, error) {
+	tpl, ok := autocompleteScripts[strings.ToLower(shell)]
+	if !ok {
+		return "", fmt.Errorf(
+			"Unsupported shell %q for the autocomplete script. Supported "+
+				"shells are: %s", shell, strings.Join(autocompleteShells, ", "))
+	}
+
+	var buf bytes.Buffer
+	t := template.Must(template.New("script").Parse(strings.TrimLeft(tpl, "\n")))
+	if err := t.Execute(&buf, map[string]string{"Cmd": cmd}); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// autocompleteScripts are the templates of the scripts per shell. The bash
+// script matches what install.Install adds to the configuration of bash.
+var autocompleteScripts = map[string]string{
+	"bash": `
+complete -C {{.Cmd}} {{.Cmd}}
+`,
+
+	"zsh": `
+#compdef {{.Cmd}}
+
+_{{.Cmd}}() {
+    local -a lines completions
+    local out line value desc directive
+
+    # Complete the words up to the cursor with the hidden complete command.
+    # The last line of its output is the directive.
+    out=$({{.Cmd}} __complete "${(@)words[2,$CURRENT]}" 2>/dev/null)
+    lines=("${(@f)out}")
+    directive=${lines[-1]#:}
+    lines=("${(@)lines[1,-2]}")
+    [[ $directive == <-> ]] || directive=0
+
+    # The candidates are file extensions
+    if (( directive & 2 )); then
+        _files -g "*.(${(j:|:)lines})"
+        return
+    fi
+
+    # Only complete directories, in the directory of the candidate if any
+    if (( directive & 4 )); then
+        if (( ${#lines} )); then
+            _files -/ -W "${lines[1]}"
+        else
+            _files -/
+        fi
+        return
+    fi
+
+    for line in $lines; do
+        value=${line%%$'\t'*}
+        desc=""
+        [[ $line == *$'\t'* ]] && desc=${line#*$'\t'}
+        completions+=("${value//:/\\:}${desc:+:$desc}")
+    done
+
+    if (( ${#completions} )) && _describe -t commands '{{.Cmd}}' completions; then
+        return
+    fi
+
+    if (( ! (directive & 1) )); then
+        _files
+    fi
+}
+
+compdef _{{.Cmd}} {{.Cmd}}
+`,
+
+	"fish": `
+function __{{.Cmd}}_complete
+    # Complete the words up to the cursor with the hidden complete command.
+    # The last line of its output is the directive.
+    set -l args (commandline -opc)
+    set -e args[1]
+    set -l current (commandline -ct)
+    set -l lines ({{.Cmd}} __complete $args $current 2>/dev/null)
+    if test (count $lines) -eq 0
+        __fish_complete_path $current
+        return
+    end
+
+    set -l directive (string replace -r '^:' '' -- $lines[-1])
+    set -e lines[-1]
+    string match -qr '^[0-9]+$' -- $directive
+    or set directive 0
+
+    # The candidates are file extensions
+    if test (math "floor($directive / 2) % 2") -eq 1
+        for ext in $lines
+            __fish_complete_suffix .$ext
+        end
+        return
+    end
+
+    # Only complete directories, in the directory of the candidate if any
+    if test (math "floor($directive / 4) % 2") -eq 1
+        if test (count $lines) -gt 0
+            if pushd $lines[1] 2>/dev/null
+                __fish_complete_directories $current
+                popd
+            end
+        else
+            __fish_complete_directories $current
+        end
+        return
+    end
+
+    # The candidates are printed as "value<tab>description" like fish wants
+    if test (count $lines) -gt 0
+        printf '%s\n' $lines
+    else if test (math "$directive % 2") -eq 0
+        __fish_complete_path $current
+    end
+end
+
+complete -c {{.Cmd}} -f -a "(__{{.Cmd}}_complete)"
+`,
+
+	"powershell": `
+Register-ArgumentCompleter -Native -CommandName '{{.Cmd}}' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $line = $commandAst.Extent.Text
+    $offset = $cursorPosition - $commandAst.Extent.StartOffset
+    if ($offset -lt $line.Length) {
+        $line = $line.Substring(0, $offset)
+    }
+    if ($wordToComplete -eq '' -and -not $line.EndsWith(' ')) {
+        $line += ' '
+    }
+
+    $env:COMP_LINE = $line
+    try {
+        & '{{.Cmd}}' | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+        }
+    } finally {
+        Remove-Item Env:\COMP_LINE
+    }
+}
+`,
+}
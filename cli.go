@@ -1,15 +1,20 @@
 package cli
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/armon/go-radix"
@@ -49,7 +54,8 @@ import (
 type CLI struct {
 	// Args is the list of command-line arguments received excluding
 	// the name of the app. For example, if the command "./cli foo bar"
-	// was invoked, then Args should be []string{"foo", "bar"}.
+	// was invoked, then Args should be []string{"foo", "bar"}. Use Invoke
+	// to run the CLI with other arguments.
 	Args []string
 
 	// Commands is a mapping of subcommand names to a factory function
@@ -69,18 +75,234 @@ type CLI struct {
 	// deferred to function calls within the interface implementation.
 	Commands map[string]CommandFactory
 
+	// CommandSpecs registers commands along with static metadata, for
+	// commands that are expensive to create. The keys are the same as for
+	// Commands. The help output, suggestions and autocomplete take the
+	// synopsis, help, category and completions of these commands from
+	// their CommandSpec, so listing them doesn't call their factories. The
+	// factory is only called to run the command or to show its help. A
+	// command in Commands takes precedence over a spec with the same name.
+	CommandSpecs map[string]CommandSpec
+
+	// EnvCommands registers commands whose factories receive a CommandEnv
+	// with the Ui, the GlobalFlags, the Name and Version, the Context and
+	// the Deps of the CLI. The keys are the same as for Commands. This lets
+	// commands share setup that is done once per run, and lets them be
+	// tested by calling the factory with a CommandEnv of their own. A
+	// command in Commands or CommandSpecs takes precedence over one in
+	// EnvCommands with the same name.
+	//
+	// Ui is the Ui given to these commands. It defaults to a BasicUi on
+	// the standard input, output and error, which is created once and
+	// shared by all of them. Deps is a container of the dependencies of
+	// the commands, such as API clients, that is defined by the
+	// application.
+	EnvCommands map[string]CommandEnvFactory
+	Ui          Ui
+	Deps        interface{}
+
 	// HiddenCommands is a list of commands that are "hidden". Hidden
 	// commands are not given to the help function callback and do not
 	// show up in autocomplete. The values in the slice should be equivalent
 	// to the keys in the command map.
 	HiddenCommands []string
 
+	// DeprecatedCommands is a mapping of command names to their
+	// deprecation. The keys should be equivalent to the keys in the
+	// command map. A deprecated command still runs, but a warning that
+	// points to its replacement is written to the ErrorWriter first.
+	//
+	// Deprecated commands are hidden from the help output, suggestions and
+	// autocomplete like hidden commands, but they are listed when the help
+	// flag is combined with "-all", such as "cli -help -all", with their
+	// synopsis marked as deprecated along with the replacement.
+	//
+	// If EnforceDeprecations is true, a deprecated command fails to run
+	// once Version is at or past the version it is removed in.
+	DeprecatedCommands  map[string]Deprecation
+	EnforceDeprecations bool
+
+	// Categories is a mapping of command names to the category they are
+	// listed under in help output that groups commands, such as
+	// "Common commands". It takes precedence over commands that implement
+	// CommandCategory. Use CategorizedHelpFunc as the HelpFunc to group the
+	// commands in the help output of the CLI itself.
+	//
+	// CategoryOrder is the order in which the categories are listed in the
+	// command help. Pass it to CategorizedHelpFunc to list the categories
+	// of the help of the CLI itself in the same order. Categories that
+	// aren't listed come after, in alphabetical order, followed by any
+	// commands without a category.
+	Categories    map[string]string
+	CategoryOrder []string
+
+	// HelpJSON enables the "-help-json" flag. Instead of the help, it
+	// writes the command tree to HelpWriter as JSON, see CommandTree. If a
+	// subcommand is given, only its part of the tree is written.
+	HelpJSON bool
+
+	// Aliases is a mapping of alternate names to the command they invoke.
+	// The key is the alias and the value is the full name of the target
+	// command as it appears in Commands, such as "ls" => "list" or
+	// "st" => "state show". Aliases can also be nested underneath an
+	// existing command, such as "state ls" => "state list".
+	//
+	// Aliases are resolved before the subcommand is looked up, so
+	// Subcommand always returns the name of the target command. Aliases are
+	// listed next to their target in the help output and are offered by
+	// autocomplete. An alias for a hidden command is hidden as well. If an
+	// alias has the same name as a command, the command wins. Aliases that
+	// loop or whose target isn't a command are ignored.
+	Aliases map[string]string
+
+	// SuggestDistance is the maximum edit distance between an unknown
+	// subcommand and a visible command at the same level for that command
+	// to be suggested. Commands that start with the unknown subcommand are
+	// always suggested. This defaults to 2. Set it to a negative value to
+	// disable suggestions.
+	//
+	// SuggestFunc returns the message written above the help output when
+	// an unknown subcommand is given, such as "Did you mean 'status'?".
+	// It is only called if there is at least one suggestion. If it returns
+	// an empty string, nothing is written. If it is nil, a default message
+	// is used.
+	SuggestDistance int
+	SuggestFunc     func(unknown string, suggestions []string) string
+
+	// Abbreviations enables resolving a unique prefix of a command name to
+	// that command at every nesting level, so that "cli st sh" runs
+	// "state show" if no other command starts with "st" or "state sh".
+	// Hidden commands must always be typed in full. If a prefix matches
+	// more than one command, the CLI exits with an error listing the
+	// candidates.
+	Abbreviations bool
+
+	// Context is the parent of the context given to commands that
+	// implement CommandContext. This defaults to context.Background().
+	//
+	// While such a command runs, the CLI handles SIGINT and SIGTERM itself:
+	// the first signal cancels the context so the command can clean up,
+	// and a second signal exits the process immediately with exit code 1.
+	// InterruptGracePeriod is the maximum amount of time to wait for the
+	// command to return after the context is cancelled before exiting the
+	// same way. If it is zero, the CLI waits until the command returns or
+	// a second signal is received. An interrupt while a BasicUi is asking
+	// for input only aborts the prompt, which returns an error, and is not
+	// counted. Commands that get the context from their CommandEnv are
+	// handled the same way. Other commands keep the default signal
+	// behavior, except in RunInteractive.
+	Context              context.Context
+	InterruptGracePeriod time.Duration
+	exitFunc             func(int) // For tests
+
+	// Middleware wraps the execution of commands. Each middleware receives
+	// the next RunFunc in the chain and returns a RunFunc that should call
+	// it, or return an exit status of its own to stop the command from
+	// running. The first middleware in the slice is the outermost one.
+	//
+	// Middleware also wraps the special paths of showing the version,
+	// showing the help and handling RunResultHelp, so that concerns such
+	// as logging or timing apply to every invocation. IsHelp and IsVersion
+	// can be used to tell them apart. When showing the version or the
+	// help for the CLI itself, the command is nil.
+	Middleware []func(next RunFunc) RunFunc
+
+	// GlobalFlags declares the flags that can be given before the
+	// subcommand, such as "-chdir=DIR". They are parsed before any command
+	// factory is called, so the variables bound to the flag set hold their
+	// values by the time commands are created. Global flags are listed in
+	// the help output of the CLI and are added to the autocompletion of
+	// global flags. Any other flag before the subcommand remains an error.
+	//
+	// GlobalFlags is parsed in place by every run, so the values of an
+	// earlier Invocation carry over to the next one. GlobalFlagsFunc
+	// creates a new flag set for every run instead, which is parsed and
+	// then available from Invocation.GlobalFlags and CommandEnv. Flags
+	// bound to variables in GlobalFlagsFunc start at their defaults again
+	// for every run. If only GlobalFlagsFunc is set, GlobalFlags is created
+	// with it once to list the flags in help and completion.
+	//
+	// The flag set should use flag.ContinueOnError. Its output is discarded
+	// and parse errors are reported by the CLI instead.
+	GlobalFlags     *flag.FlagSet
+	GlobalFlagsFunc func() *flag.FlagSet
+
+	// PluginDirs and PluginPath enable git-style external subcommands. An
+	// executable named "<Name>-<subcommand>" in one of the PluginDirs, or
+	// in one of the directories on $PATH if PluginPath is true, is added
+	// as the subcommand "<subcommand>". The plugin directories are searched
+	// before $PATH and the first executable found wins. A command in the
+	// Commands mapping always takes precedence over a plugin.
+	//
+	// A plugin is run with the subcommand arguments and shares the stdin,
+	// stdout and stderr of the CLI. Its exit status is the exit status of
+	// the CLI. While it runs, the CLI waits for it to exit on an interrupt
+	// rather than exiting itself, and passes SIGTERM on to it. The
+	// synopsis of a plugin is read from a "<Name>-<subcommand>.synopsis"
+	// file next to the executable if it exists, and otherwise from the
+	// output of running the plugin with "--synopsis". The help of a plugin
+	// is the output of running it with "--help".
+	//
+	// Plugins are otherwise treated like any other command, so they are
+	// listed in the help output, autocompleted, and can be hidden with
+	// HiddenCommands. Plugins require Name to be set.
+	PluginDirs []string
+	PluginPath bool
+
+	// EnvArgsPrefix enables default arguments from the environment. If it
+	// is set to "APP", the arguments in APP_CLI_ARGS are given to every
+	// subcommand and the arguments in APP_CLI_ARGS_<subcommand> are given
+	// only to that subcommand. In the variable name, spaces and hyphens in
+	// the subcommand are replaced by underscores, so the variable for
+	// "state show" is APP_CLI_ARGS_state_show. The values are split into
+	// arguments using shell quoting rules and are inserted before the
+	// arguments given on the command line, so that flags given on the
+	// command line take precedence.
+	EnvArgsPrefix string
+
+	// ResponseFiles enables expanding response files in Args. Every
+	// argument of the form "@file" is replaced by the arguments read from
+	// that file before the arguments are processed, so this works the same
+	// for every subcommand. Response files are split into arguments using
+	// shell quoting rules, may contain comments starting with "#", and may
+	// reference other response files up to 10 levels deep. An argument of
+	// the form "@@arg" is passed on as the literal "@arg". Arguments after
+	// "--" are not expanded.
+	ResponseFiles bool
+
+	// RecoverPanics recovers from a panic while running the CLI, such as
+	// in a CommandFactory or in the Run of a command. Instead of the raw
+	// stack trace, the user gets a short message that asks them to report
+	// the bug and points at a crash log, and Run returns PanicExitCode.
+	//
+	// The crash log is written to CrashLogDir, or the temporary directory
+	// if it is empty. It contains the args, the version, the Go version
+	// and the stack of every goroutine. CrashRedactFunc, if set, is called
+	// with the args before they are written so that secrets such as tokens
+	// can be removed.
+	//
+	// PanicExitCode is the exit status after a panic. It defaults to 70,
+	// which is EX_SOFTWARE from sysexits.h.
+	RecoverPanics   bool
+	CrashLogDir     string
+	CrashRedactFunc func(args []string) []string
+	PanicExitCode   int
+
+	// Prompt is the prompt of RunInteractive. It defaults to the Name
+	// followed by "> ".
+	Prompt string
+
 	// Name defines the name of the CLI.
 	Name string
 
 	// Version of the CLI.
 	Version string
 
+	// VersionFields are additional fields that are shown by the version
+	// flag and the version command next to the metadata of the build,
+	// such as {"Plugin protocol": "5"}. See VersionInfo.
+	VersionFields map[string]string
+
 	// Autocomplete enables or disables subcommand auto-completion support.
 	// This is enabled by default when NewCLI is called. Otherwise, this
 	// must enabled explicitly.
@@ -99,6 +321,21 @@ type CLI struct {
 	// for the flag name. These default to `autocomplete-install` and
 	// `autocomplete-uninstall` respectively.
 	//
+	// AutocompleteScript is the global flag name for printing the
+	// completion script for a shell to stdout instead of installing it,
+	// such as `-autocomplete-script=zsh`. This is meant for packages and
+	// for users that manage their own shell configuration. The supported
+	// shells are bash, zsh, fish and powershell. The script runs the binary
+	// by its Name, so it must be on the PATH. This defaults to
+	// `autocomplete-script`.
+	//
+	// Autocomplete also enables the hidden "__complete" command, which
+	// prints the completions for the words that follow it along with
+	// their descriptions and a CompletionDirective. The scripts for zsh
+	// and fish use it instead of COMP_LINE so that they show the
+	// descriptions, and it makes completions easy to test. Commands can implement
+	// CommandComplete to provide the completions of their arguments.
+	//
 	// AutocompleteNoDefaultFlags is a boolean which controls if the default auto-
 	// complete flags like -help and -version are added to the output.
 	//
@@ -107,9 +344,11 @@ type CLI struct {
 	Autocomplete               bool
 	AutocompleteInstall        string
 	AutocompleteUninstall      string
+	AutocompleteScript         string
 	AutocompleteNoDefaultFlags bool
 	AutocompleteGlobalFlags    complete.Flags
 	autocompleteInstaller      autocompleteInstaller // For tests
+	autocompleteWriter         io.Writer             // For tests
 
 	// HelpFunc is the function called to generate the generic help
 	// text that is shown if help must be shown for the CLI that doesn't
@@ -136,16 +375,18 @@ type CLI struct {
 	commandTree    *radix.Tree
 	commandNested  bool
 	commandHidden  map[string]struct{}
-	subcommand     string
-	subcommandArgs []string
-	topFlags       []string
-
-	// These are true when special global flags are set. We can/should
-	// probably use a bitset for this one day.
-	isHelp                  bool
-	isVersion               bool
-	isAutocompleteInstall   bool
-	isAutocompleteUninstall bool
+	commandAliases map[string]string
+	aliasTargets   map[string][]string
+	commandSpecs   map[string]*CommandSpec
+	envCommands    map[string]CommandEnvFactory
+
+	// commandGenerated are the parent commands that were created
+	// because they were missing.
+	commandGenerated map[string]struct{}
+
+	// invocation is the invocation for Args, which the methods of the
+	// CLI such as Run and Subcommand refer to.
+	invocation *Invocation
 }
 
 // NewClI returns a new CLI instance with sensible defaults.
@@ -163,19 +404,40 @@ func NewCLI(app, version string) *CLI {
 // arguments.
 func (c *CLI) IsHelp() bool {
 	c.once.Do(c.init)
-	return c.isHelp
+	return c.invocation.IsHelp()
 }
 
 // IsVersion returns whether or not the version flag is present within the
 // arguments.
 func (c *CLI) IsVersion() bool {
 	c.once.Do(c.init)
-	return c.isVersion
+	return c.invocation.IsVersion()
 }
 
 // Run runs the actual CLI based on the arguments given.
-func (c *CLI) Run() (int, error) {
+func (c *CLI) Run() (exitCode int, err error) {
+	if c.RecoverPanics {
+		defer c.recoverPanic(c.Args, &exitCode, &err)
+	}
+
 	c.once.Do(c.init)
+	return c.invocation.Run()
+}
+
+// Run runs the CLI with the arguments of the invocation.
+func (inv *Invocation) Run() (exitCode int, err error) {
+	c := inv.cli
+	if c.RecoverPanics {
+		defer c.recoverPanic(inv.args, &exitCode, &err)
+	}
+
+	// Release the context of the run if the command was given one
+	defer func() {
+		if inv.cancel != nil {
+			inv.cancel()
+			inv.ctx, inv.cancel = nil, nil
+		}
+	}()
 
 	// If this is a autocompletion request, satisfy it. This must be called
 	// first before anything else since its possible to be autocompleting
@@ -185,16 +447,33 @@ func (c *CLI) Run() (int, error) {
 		return 0, nil
 	}
 
+	// Satisfy a request to the hidden complete command, which comes
+	// before anything else for the same reason.
+	if inv.isComplete {
+		return inv.writeCompletions(), nil
+	}
+
 	// Just show the version and exit if instructed.
-	if c.IsVersion() && c.Version != "" {
-		c.HelpWriter.Write([]byte(c.Version + "\n"))
-		return 0, nil
+	if inv.isVersion && c.Version != "" {
+		return c.runMiddleware("", inv.subcommandArgs, nil, func(string, []string, Command) int {
+			c.writeVersion(inv.isVersionJSON)
+			return 0
+		}), nil
+	}
+
+	// Write the command tree as JSON if requested.
+	if inv.isHelpJSON {
+		return c.runMiddleware("", inv.subcommandArgs, nil, func(string, []string, Command) int {
+			return c.writeCommandTreeJSON(inv.subcommand)
+		}), nil
 	}
 
 	// Just print the help when only '-h' or '--help' is passed.
-	if c.IsHelp() && c.Subcommand() == "" {
-		c.HelpWriter.Write([]byte(c.HelpFunc(c.helpCommands(c.Subcommand())) + "\n"))
-		return 0, nil
+	if inv.isHelp && inv.subcommand == "" {
+		return c.runMiddleware("", inv.subcommandArgs, nil, func(string, []string, Command) int {
+			c.HelpWriter.Write([]byte(c.helpText(inv.subcommand, inv.isHelpAll) + "\n"))
+			return 0
+		}), nil
 	}
 
 	// If we're attempting to install or uninstall autocomplete then handle
@@ -207,14 +486,40 @@ func (c *CLI) Run() (int, error) {
 		}
 
 		// If both install and uninstall flags are specified, then error
-		if c.isAutocompleteInstall && c.isAutocompleteUninstall {
+		if inv.isAutocompleteInstall && inv.isAutocompleteUninstall {
 			return 1, fmt.Errorf(
 				"Either the autocomplete install or uninstall flag may " +
 					"be specified, but not both.")
 		}
 
+		// Printing the script doesn't touch the shell configuration, so it
+		// can't be combined with the flags that do.
+		if inv.isAutocompleteScript {
+			if inv.isAutocompleteInstall || inv.isAutocompleteUninstall {
+				return 1, fmt.Errorf(
+					"The autocomplete script flag may not be specified " +
+						"with the autocomplete install or uninstall flag.")
+			}
+
+			script, err := autocompleteScript(inv.autocompleteShell, c.Name)
+			if err != nil {
+				return 1, err
+			}
+
+			w := c.autocompleteWriter
+			if w == nil {
+				w = os.Stdout
+			}
+
+			if _, err := io.WriteString(w, script); err != nil {
+				return 1, err
+			}
+
+			return 0, nil
+		}
+
 		// If the install flag is specified, perform the install or uninstall
-		if c.isAutocompleteInstall {
+		if inv.isAutocompleteInstall {
 			if err := c.autocompleteInstaller.Install(c.Name); err != nil {
 				return 1, err
 			}
@@ -222,7 +527,7 @@ func (c *CLI) Run() (int, error) {
 			return 0, nil
 		}
 
-		if c.isAutocompleteUninstall {
+		if inv.isAutocompleteUninstall {
 			if err := c.autocompleteInstaller.Uninstall(c.Name); err != nil {
 				return 1, err
 			}
@@ -231,42 +536,216 @@ func (c *CLI) Run() (int, error) {
 		}
 	}
 
+	// If the subcommand couldn't be determined, such as due to an ambiguous
+	// abbreviation, show the error along with the help for where we are.
+	if err, ok := inv.subcommandErr.(*ambiguousCommandError); ok {
+		c.ErrorWriter.Write([]byte(err.Error() + "\n\n"))
+		c.ErrorWriter.Write([]byte(c.helpText(err.Parent, inv.isHelpAll) + "\n"))
+		return 127, nil
+	}
+
+	// If the arguments couldn't be processed, there is nothing we can run
+	if inv.argsErr != nil {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", inv.argsErr)))
+		return 1, nil
+	}
+
+	// Parse the global flags now so that their values are available to
+	// the command factories.
+	if c.GlobalFlags != nil {
+		inv.globalFlags = c.GlobalFlags
+		if c.GlobalFlagsFunc != nil {
+			inv.globalFlags = c.GlobalFlagsFunc()
+			inv.globalFlags.SetOutput(ioutil.Discard)
+		}
+
+		if err := inv.globalFlags.Parse(inv.globalArgs); err != nil {
+			c.ErrorWriter.Write([]byte(fmt.Sprintf(
+				"Error parsing global flags: %s\n\n", err)))
+			c.ErrorWriter.Write([]byte(c.helpText("", inv.isHelpAll) + "\n"))
+			return 1, nil
+		}
+	}
+
 	// Attempt to get the factory function for creating the command
 	// implementation. If the command is invalid or blank, it is an error.
-	raw, ok := c.commandTree.Get(c.Subcommand())
+	raw, ok := c.commandTree.Get(inv.subcommand)
 	if !ok {
-		c.ErrorWriter.Write([]byte(c.HelpFunc(c.helpCommands(c.subcommandParent())) + "\n"))
+		parent := inv.subcommandParent()
+		unknown := strings.TrimPrefix(inv.subcommand, parent)
+		c.writeSuggestions(parent, strings.TrimSpace(unknown))
+		c.ErrorWriter.Write([]byte(c.helpText(parent, inv.isHelpAll) + "\n"))
 		return 127, nil
 	}
 
-	command, err := raw.(CommandFactory)()
+	command, err := inv.runFactory(inv.subcommand, raw.(CommandFactory))()
 	if err != nil {
 		return 1, err
 	}
 
 	// If we've been instructed to just print the help, then print it
-	if c.IsHelp() {
-		c.commandHelp(c.HelpWriter, command)
-		return 0, nil
+	if inv.isHelp {
+		return c.runMiddleware(inv.subcommand, inv.subcommandArgs, command, func(_ string, _ []string, command Command) int {
+			inv.commandHelp(c.HelpWriter, command)
+			return 0
+		}), nil
 	}
 
 	// If there is an invalid flag, then error
-	if len(c.topFlags) > 0 {
+	if len(inv.topFlags) > 0 {
 		c.ErrorWriter.Write([]byte(
 			"Invalid flags before the subcommand. If these flags are for\n" +
 				"the subcommand, please put them after the subcommand.\n\n"))
-		c.commandHelp(c.ErrorWriter, command)
+		inv.commandHelp(c.ErrorWriter, command)
 		return 1, nil
 	}
 
-	code := command.Run(c.SubcommandArgs())
-	if code == RunResultHelp {
-		// Requesting help
-		c.commandHelp(c.ErrorWriter, command)
-		return 1, nil
+	// Warn if the command is deprecated, or refuse to run it if it has
+	// been removed by now.
+	if d, ok := c.DeprecatedCommands[inv.subcommand]; ok {
+		if c.EnforceDeprecations && d.isRemoved(c.Version) {
+			c.ErrorWriter.Write([]byte(d.removed(inv.subcommand) + "\n"))
+			return 1, nil
+		}
+
+		c.ErrorWriter.Write([]byte(d.warning(inv.subcommand, c.Version) + "\n\n"))
 	}
 
-	return code, nil
+	return c.runMiddleware(inv.subcommand, inv.subcommandArgs, command, func(name string, args []string, command Command) int {
+		// If the command declares its flags, parse them for it.
+		if cf, ok := command.(CommandFlags); ok {
+			if fs := cf.Flags(); fs != nil {
+				fs.SetOutput(ioutil.Discard)
+				if err := fs.Parse(args); err != nil {
+					c.ErrorWriter.Write([]byte(fmt.Sprintf(
+						"Error parsing command-line flags: %s\n\n", err)))
+					inv.commandHelp(c.ErrorWriter, command)
+					return 1
+				}
+
+				args = fs.Args()
+			}
+		}
+
+		code := inv.runCommand(command, args)
+		if code == RunResultHelp {
+			// Requesting help. If the first argument looks like it was
+			// meant to be a subcommand, help the user out with a suggestion.
+			if len(args) > 0 && c.commandNested {
+				c.writeSuggestions(name, args[0])
+			}
+
+			inv.commandHelp(c.ErrorWriter, command)
+			return 1
+		}
+
+		return code
+	}), nil
+}
+
+// runMiddleware calls f wrapped in all of the configured middleware.
+func (c *CLI) runMiddleware(name string, args []string, command Command, f RunFunc) int {
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		f = c.Middleware[i](f)
+	}
+
+	return f(name, args, command)
+}
+
+// runCommand runs the command with the given arguments. If the command
+// implements CommandContext, it is run with a context that is cancelled
+// on the first interrupt. If it implements CommandE, the returned error
+// is reported.
+func (inv *Invocation) runCommand(command Command, args []string) int {
+	cc, ok := command.(CommandContext)
+
+	// Interrupts cancel the context of the run if the command has it,
+	// either from RunContext or from its CommandEnv.
+	if ok || inv.ctx != nil {
+		inv.runContext()
+
+		sigCh := make(chan os.Signal, 2)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+
+		// An interrupt while a BasicUi is asking only aborts the prompt
+		intCh, stop := filterPromptInterrupts(sigCh, doneCh)
+		defer stop()
+		go inv.handleInterrupts(intCh, doneCh)
+	}
+
+	if ok {
+		return cc.RunContext(inv.ctx, args)
+	}
+
+	if ce, ok := command.(CommandE); ok {
+		return inv.handleError(command, ce.RunE(args))
+	}
+
+	return command.Run(args)
+}
+
+// runContext returns the context of the run, which is cancelled on an
+// interrupt while the command runs and once the run is over.
+func (inv *Invocation) runContext() context.Context {
+	if inv.ctx == nil {
+		ctx := inv.cli.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		inv.ctx, inv.cancel = context.WithCancel(ctx)
+	}
+
+	return inv.ctx
+}
+
+// handleInterrupts cancels the running command on the first signal and
+// exits the process on the second one or once the grace period is over.
+// In an interactive shell it only cancels the command. It returns when
+// doneCh is closed.
+func (inv *Invocation) handleInterrupts(sigCh <-chan os.Signal, doneCh <-chan struct{}) {
+	c := inv.cli
+	select {
+	case <-sigCh:
+		inv.cancel()
+	case <-doneCh:
+		return
+	}
+
+	// Exiting would also end the shell, which waits for the command to
+	// return instead.
+	if inv.interactive {
+		return
+	}
+
+	var timeoutCh <-chan time.Time
+	if c.InterruptGracePeriod > 0 {
+		timer := time.NewTimer(c.InterruptGracePeriod)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-sigCh:
+		c.ErrorWriter.Write([]byte(
+			"Two interrupts received. Exiting immediately.\n"))
+	case <-timeoutCh:
+		c.ErrorWriter.Write([]byte(
+			"The command did not stop in time after the interrupt. Exiting immediately.\n"))
+	case <-doneCh:
+		return
+	}
+
+	exit := c.exitFunc
+	if exit == nil {
+		exit = os.Exit
+	}
+
+	exit(1)
 }
 
 // Subcommand returns the subcommand that the CLI would execute. For
@@ -274,21 +753,21 @@ func (c *CLI) Run() (int, error) {
 // of "version"
 func (c *CLI) Subcommand() string {
 	c.once.Do(c.init)
-	return c.subcommand
+	return c.invocation.Subcommand()
 }
 
 // SubcommandArgs returns the arguments that will be passed to the
 // subcommand.
 func (c *CLI) SubcommandArgs() []string {
 	c.once.Do(c.init)
-	return c.subcommandArgs
+	return c.invocation.SubcommandArgs()
 }
 
 // subcommandParent returns the parent of this subcommand, if there is one.
 // If there isn't on, "" is returned.
-func (c *CLI) subcommandParent() string {
+func (inv *Invocation) subcommandParent() string {
 	// Get the subcommand, if it is "" alread just return
-	sub := c.Subcommand()
+	sub := inv.subcommand
 	if sub == "" {
 		return sub
 	}
@@ -321,6 +800,21 @@ func (c *CLI) init() {
 		c.ErrorWriter = c.HelpWriter
 	}
 
+	if c.GlobalFlags == nil && c.GlobalFlagsFunc != nil {
+		c.GlobalFlags = c.GlobalFlagsFunc()
+	}
+	if c.GlobalFlags != nil {
+		c.GlobalFlags.SetOutput(ioutil.Discard)
+	}
+
+	if c.Ui == nil {
+		c.Ui = &BasicUi{
+			Reader:      os.Stdin,
+			Writer:      os.Stdout,
+			ErrorWriter: os.Stderr,
+		}
+	}
+
 	// Build our hidden commands
 	if len(c.HiddenCommands) > 0 {
 		c.commandHidden = make(map[string]struct{})
@@ -331,6 +825,7 @@ func (c *CLI) init() {
 
 	// Build our command tree
 	c.commandTree = radix.New()
+	c.commandGenerated = nil
 	c.commandNested = false
 	for k, v := range c.Commands {
 		k = strings.TrimSpace(k)
@@ -340,6 +835,62 @@ func (c *CLI) init() {
 		}
 	}
 
+	// Add the commands with specs. Commands take precedence over them.
+	c.commandSpecs = nil
+	for k, spec := range c.CommandSpecs {
+		k = strings.TrimSpace(k)
+		if _, ok := c.commandTree.Get(k); ok {
+			continue
+		}
+
+		if c.commandSpecs == nil {
+			c.commandSpecs = make(map[string]*CommandSpec)
+		}
+
+		spec := spec
+		c.commandSpecs[k] = &spec
+		c.commandTree.Insert(k, spec.Factory)
+		if strings.ContainsRune(k, ' ') {
+			c.commandNested = true
+		}
+
+		if spec.Hidden {
+			if c.commandHidden == nil {
+				c.commandHidden = make(map[string]struct{})
+			}
+
+			c.commandHidden[k] = struct{}{}
+		}
+	}
+
+	// Add the commands whose factories receive the environment, unless
+	// there is already a command with the same name.
+	c.envCommands = nil
+	for k, f := range c.EnvCommands {
+		k = strings.TrimSpace(k)
+		if _, ok := c.commandTree.Get(k); ok {
+			continue
+		}
+
+		if c.envCommands == nil {
+			c.envCommands = make(map[string]CommandEnvFactory)
+		}
+
+		c.envCommands[k] = f
+		c.commandTree.Insert(k, c.envCommandFactory(k, f))
+		if strings.ContainsRune(k, ' ') {
+			c.commandNested = true
+		}
+	}
+
+	// Add any external plugins. Registered commands always take precedence
+	// over them.
+	for k, path := range c.discoverPlugins() {
+		if _, ok := c.commandTree.Get(k); !ok {
+			c.commandTree.Insert(k, pluginCommandFactory(path))
+		}
+	}
+
 	// Go through the key and fill in any missing parent commands
 	if c.commandNested {
 		var walkFn radix.WalkFn
@@ -369,6 +920,7 @@ func (c *CLI) init() {
 		c.commandTree.Walk(walkFn)
 
 		// Insert any that we're missing
+		c.commandGenerated = toInsert
 		for k := range toInsert {
 			var f CommandFactory = func() (Command, error) {
 				return &MockCommand{
@@ -381,6 +933,53 @@ func (c *CLI) init() {
 		}
 	}
 
+	// Build our aliases. An alias may point to another alias so we follow
+	// the chain to the real command. This is done once the command tree is
+	// complete, so that aliases that loop or whose target isn't a command
+	// can be dropped rather than fail as unknown commands.
+	c.commandAliases = nil
+	c.aliasTargets = nil
+	if len(c.Aliases) > 0 {
+		c.commandAliases = make(map[string]string, len(c.Aliases))
+		c.aliasTargets = make(map[string][]string)
+		for k, v := range c.Aliases {
+			k = strings.TrimSpace(k)
+			v = strings.TrimSpace(v)
+			if k == "" || v == "" {
+				continue
+			}
+
+			seen := map[string]struct{}{k: {}}
+			for {
+				if _, ok := c.commandTree.Get(v); ok {
+					break
+				}
+
+				next, ok := c.Aliases[v]
+				if !ok {
+					break
+				}
+				if _, ok := seen[v]; ok {
+					break
+				}
+
+				seen[v] = struct{}{}
+				v = strings.TrimSpace(next)
+			}
+
+			if _, ok := c.commandTree.Get(v); !ok {
+				continue
+			}
+
+			c.commandAliases[k] = v
+			c.aliasTargets[v] = append(c.aliasTargets[v], k)
+		}
+
+		for _, v := range c.aliasTargets {
+			sort.Strings(v)
+		}
+	}
+
 	// Setup autocomplete if we have it enabled. We have to do this after
 	// the command tree is setup so we can use the radix tree to easily find
 	// all subcommands.
@@ -389,7 +988,7 @@ func (c *CLI) init() {
 	}
 
 	// Process the args
-	c.processArgs()
+	c.invocation = c.newInvocation(c.Args)
 }
 
 func (c *CLI) initAutocomplete() {
@@ -401,6 +1000,10 @@ func (c *CLI) initAutocomplete() {
 		c.AutocompleteUninstall = defaultAutocompleteUninstall
 	}
 
+	if c.AutocompleteScript == "" {
+		c.AutocompleteScript = defaultAutocompleteScript
+	}
+
 	if c.autocompleteInstaller == nil {
 		c.autocompleteInstaller = &realAutocompleteInstaller{}
 	}
@@ -424,12 +1027,27 @@ func (c *CLI) initAutocomplete() {
 		cmd.Flags = map[string]complete.Predictor{
 			"-" + c.AutocompleteInstall:   complete.PredictNothing,
 			"-" + c.AutocompleteUninstall: complete.PredictNothing,
+			"-" + c.AutocompleteScript:    complete.PredictSet(autocompleteShells...),
 			"-help":                       complete.PredictNothing,
 			"-version":                    complete.PredictNothing,
 		}
+
+		if c.HelpJSON {
+			cmd.Flags["-help-json"] = complete.PredictNothing
+		}
 	}
 	cmd.GlobalFlags = c.AutocompleteGlobalFlags
 
+	// Add any declared global flags that weren't given explicitly.
+	if c.GlobalFlags != nil {
+		flags := flagsPredictors(c.GlobalFlags)
+		for k, v := range c.AutocompleteGlobalFlags {
+			flags[k] = v
+		}
+
+		cmd.GlobalFlags = flags
+	}
+
 	c.autocomplete = complete.New(c.Name, cmd)
 }
 
@@ -465,32 +1083,19 @@ func (c *CLI) initAutocompleteSub(prefix string) complete.Command {
 			return false
 		}
 
-		// If the command is hidden, don't record it at all
+		// If the command is hidden or deprecated, don't record it at all
 		if _, ok := c.commandHidden[fullKey]; ok {
 			return false
 		}
+		if _, ok := c.DeprecatedCommands[fullKey]; ok {
+			return false
+		}
 
 		if cmd.Sub == nil {
 			cmd.Sub = complete.Commands(make(map[string]complete.Command))
 		}
-		subCmd := c.initAutocompleteSub(fullKey)
-
-		// Instantiate the command so that we can check if the command is
-		// a CommandAutocomplete implementation. If there is an error
-		// creating the command, we just ignore it since that will be caught
-		// later.
-		impl, err := raw.(CommandFactory)()
-		if err != nil {
-			impl = nil
-		}
-
-		// Check if it implements ComandAutocomplete. If so, setup the autocomplete
-		if c, ok := impl.(CommandAutocomplete); ok {
-			subCmd.Args = c.AutocompleteArgs()
-			subCmd.Flags = c.AutocompleteFlags()
-		}
 
-		cmd.Sub[k] = subCmd
+		cmd.Sub[k] = c.autocompleteCommand(fullKey, raw.(CommandFactory))
 		return false
 	}
 
@@ -500,10 +1105,104 @@ func (c *CLI) initAutocompleteSub(prefix string) complete.Command {
 	}
 
 	c.commandTree.WalkPrefix(walkPrefix, walkFn)
+
+	// Offer any aliases that live at this level next to the real commands.
+	for alias, target := range c.commandAliases {
+		if !strings.HasPrefix(alias, walkPrefix) || strings.Contains(alias[len(walkPrefix):], " ") {
+			continue
+		}
+
+		if _, ok := c.commandHidden[target]; ok {
+			continue
+		}
+		if _, ok := c.DeprecatedCommands[target]; ok {
+			continue
+		}
+
+		raw, ok := c.commandTree.Get(target)
+		if !ok {
+			continue
+		}
+
+		k := alias[len(walkPrefix):]
+		if _, ok := cmd.Sub[k]; ok {
+			continue
+		}
+
+		if cmd.Sub == nil {
+			cmd.Sub = complete.Commands(make(map[string]complete.Command))
+		}
+
+		cmd.Sub[k] = c.autocompleteCommand(target, raw.(CommandFactory))
+	}
+
 	return cmd
 }
 
-func (c *CLI) commandHelp(out io.Writer, command Command) {
+// autocompleteCommand creates the complete.Command for the command with
+// the given full key, including all of its subcommands.
+func (c *CLI) autocompleteCommand(key string, f CommandFactory) complete.Command {
+	cmd := c.initAutocompleteSub(key)
+
+	// Commands with a spec are completed without creating them
+	if spec, ok := c.commandSpecs[key]; ok {
+		cmd.Args = spec.AutocompleteArgs
+		cmd.Flags = spec.AutocompleteFlags
+		return cmd
+	}
+
+	// Instantiate the command so that we can check if the command is
+	// a CommandAutocomplete implementation. If there is an error
+	// creating the command, we just ignore it since that will be caught
+	// later.
+	impl, err := f()
+	if err != nil {
+		impl = nil
+	}
+
+	// Check if it implements ComandAutocomplete. If so, setup the autocomplete.
+	if ac, ok := impl.(CommandAutocomplete); ok {
+		cmd.Args = ac.AutocompleteArgs()
+	}
+	cmd.Flags = autocompleteFlags(impl)
+
+	return cmd
+}
+
+// autocompleteFlags returns the flags that are completed for the command.
+// If it doesn't implement CommandAutocomplete we can still complete the
+// flags if we know about them.
+func autocompleteFlags(command Command) complete.Flags {
+	if ac, ok := command.(CommandAutocomplete); ok {
+		return ac.AutocompleteFlags()
+	}
+
+	if cf, ok := command.(CommandFlags); ok {
+		if fs := cf.Flags(); fs != nil {
+			return flagsPredictors(fs)
+		}
+	}
+
+	return nil
+}
+
+// flagsPredictors returns the autocomplete predictors for the flags in the
+// given flag set. Flags that take a value predict anything.
+func flagsPredictors(fs *flag.FlagSet) complete.Flags {
+	result := make(complete.Flags)
+	fs.VisitAll(func(f *flag.Flag) {
+		result["-"+f.Name] = complete.PredictAnything
+		if isBoolFlag(f) {
+			result["-"+f.Name] = complete.PredictNothing
+		}
+	})
+
+	return result
+}
+
+func (inv *Invocation) commandHelp(out io.Writer, command Command) {
+	c := inv.cli
+
 	// Get the template to use
 	tpl := strings.TrimSpace(defaultHelpTemplate)
 	if t, ok := command.(CommandHelpTemplate); ok {
@@ -520,18 +1219,42 @@ func (c *CLI) commandHelp(out io.Writer, command Command) {
 			"Internal error! Failed to parse command help template: %s\n", err)))
 	}
 
-	// Template data
+	// Write
+	err = t.Execute(out, c.commandHelpData(inv.subcommand, command, inv.isHelpAll))
+	if err == nil {
+		return
+	}
+
+	// An error, just output...
+	c.ErrorWriter.Write([]byte(fmt.Sprintf(
+		"Internal error rendering help: %s", err)))
+}
+
+// commandHelpData returns the data that the help template of the command
+// with the given full name is rendered with. See CommandHelpTemplate for
+// the keys. If all is true, deprecated subcommands are included.
+func (c *CLI) commandHelpData(name string, command Command, all bool) map[string]interface{} {
 	data := map[string]interface{}{
 		"Name":           c.Name,
-		"SubcommandName": c.Subcommand(),
+		"SubcommandName": name,
 		"Help":           command.Help(),
+		"Options":        "",
+	}
+
+	// Build the options if the command declares its flags
+	if cf, ok := command.(CommandFlags); ok {
+		if fs := cf.Flags(); fs != nil {
+			data["Options"] = strings.TrimRight(flagsHelp(fs), "\n")
+		}
 	}
 
 	// Build subcommand list if we have it
 	var subcommandsTpl []map[string]interface{}
+	groups := make(map[string][]helpEntry)
+	categorized := false
 	if c.commandNested {
 		// Get the matching keys
-		subcommands := c.helpCommands(c.Subcommand())
+		subcommands := c.helpCommands(name, all)
 		keys := make([]string, 0, len(subcommands))
 		for k := range subcommands {
 			keys = append(keys, k)
@@ -540,10 +1263,23 @@ func (c *CLI) commandHelp(out io.Writer, command Command) {
 		// Sort the keys
 		sort.Strings(keys)
 
-		// Figure out the padding length
+		// Figure out the names to display along with any aliases, and the
+		// padding length so that they line up.
 		var longest int
+		display := make(map[string]string, len(keys))
 		for _, k := range keys {
-			if v := len(k); v > longest {
+			// Find the last space and make sure we only include that last part
+			name := k
+			if idx := strings.LastIndex(k, " "); idx > -1 {
+				name = name[idx+1:]
+			}
+
+			display[k] = name
+			if aliases := c.aliasNames(k); len(aliases) > 0 {
+				display[k] = fmt.Sprintf("%s (%s)", name, strings.Join(aliases, ", "))
+			}
+
+			if v := len(display[k]); v > longest {
 				longest = v
 			}
 		}
@@ -561,6 +1297,7 @@ func (c *CLI) commandHelp(out io.Writer, command Command) {
 			if err != nil {
 				c.ErrorWriter.Write([]byte(fmt.Sprintf(
 					"Error instantiating %q: %s", k, err)))
+				continue
 			}
 
 			// Find the last space and make sure we only include that last part
@@ -569,30 +1306,72 @@ func (c *CLI) commandHelp(out io.Writer, command Command) {
 				name = name[idx+1:]
 			}
 
+			category := commandCategory(sub)
 			subcommandsTpl = append(subcommandsTpl, map[string]interface{}{
 				"Name":        name,
-				"NameAligned": name + strings.Repeat(" ", longest-len(k)),
+				"NameAligned": display[k] + strings.Repeat(" ", longest-len(display[k])),
+				"Aliases":     c.aliasNames(k),
+				"Category":    category,
 				"Help":        sub.Help(),
 				"Synopsis":    sub.Synopsis(),
 			})
+
+			groups[category] = append(groups[category], helpEntry{Name: k})
+			if category != "" {
+				categorized = true
+			}
 		}
 	}
 	data["Subcommands"] = subcommandsTpl
 
-	// Write
-	err = t.Execute(out, data)
-	if err == nil {
-		return
+	// Group the subcommands by category, but only if any of them has one
+	var categoriesTpl []map[string]interface{}
+	if categorized {
+		for _, category := range orderCategories(groups, c.CategoryOrder) {
+			var subs []map[string]interface{}
+			for _, sub := range subcommandsTpl {
+				if sub["Category"] == category {
+					subs = append(subs, sub)
+				}
+			}
+
+			name := category
+			if name == "" {
+				name = "Other subcommands"
+			}
+
+			categoriesTpl = append(categoriesTpl, map[string]interface{}{
+				"Name":        name,
+				"Subcommands": subs,
+			})
+		}
 	}
+	data["SubcommandCategories"] = categoriesTpl
 
-	// An error, just output...
-	c.ErrorWriter.Write([]byte(fmt.Sprintf(
-		"Internal error rendering help: %s", err)))
+	return data
+}
+
+// helpText returns the output of the HelpFunc for the subcommands of the
+// given prefix. At the root, the global flags are listed as well. If all
+// is true, deprecated commands are included.
+func (c *CLI) helpText(prefix string, all bool) string {
+	text := c.HelpFunc(c.helpCommands(prefix, all))
+	if prefix != "" || c.GlobalFlags == nil {
+		return text
+	}
+
+	options := flagsHelp(c.GlobalFlags)
+	if options == "" {
+		return text
+	}
+
+	return strings.TrimRight(text, "\n") + "\n\nGlobal options:\n" + options
 }
 
 // helpCommands returns the subcommands for the HelpFunc argument.
-// This will only contain immediate subcommands.
-func (c *CLI) helpCommands(prefix string) map[string]CommandFactory {
+// This will only contain immediate subcommands. If all is true,
+// deprecated commands are included.
+func (c *CLI) helpCommands(prefix string, all bool) map[string]CommandFactory {
 	// If our prefix isn't empty, make sure it ends in ' '
 	if prefix != "" && prefix[len(prefix)-1] != ' ' {
 		prefix += " "
@@ -623,59 +1402,253 @@ func (c *CLI) helpCommands(prefix string) map[string]CommandFactory {
 			continue
 		}
 
-		result[k] = raw.(CommandFactory)
+		// Deprecated commands are only shown if all commands are
+		// requested, and are marked as such.
+		var deprecation *Deprecation
+		if d, ok := c.DeprecatedCommands[k]; ok {
+			if !all {
+				continue
+			}
+
+			deprecation = &d
+		}
+
+		f := c.listFactory(k, raw.(CommandFactory))
+		if aliases, category := c.aliasNames(k), c.Categories[k]; len(aliases) > 0 || category != "" || deprecation != nil {
+			f = helpCommandFactory(f, aliases, category, deprecation)
+		}
+
+		result[k] = f
 	}
 
 	return result
 }
 
-func (c *CLI) processArgs() {
-	for i, arg := range c.Args {
+// aliasNames returns the aliases of the command with the given full key
+// for display next to it. Aliases that live under the same parent as the
+// command are shortened to their last word, i.e. "state ls" for
+// "state list" becomes "ls".
+func (c *CLI) aliasNames(k string) []string {
+	aliases := c.aliasTargets[k]
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	parent := ""
+	if idx := strings.LastIndex(k, " "); idx > -1 {
+		parent = k[:idx+1]
+	}
+
+	result := make([]string, len(aliases))
+	for i, alias := range aliases {
+		result[i] = strings.TrimPrefix(alias, parent)
+	}
+
+	return result
+}
+
+// expandSubcommand rewrites the given subcommand words by replacing any
+// alias with the words of its target command and, if Abbreviations is
+// enabled, any unique prefix with the full command name. Since a single
+// alias may expand into multiple words, the second return value records
+// for each resulting word how many of the original words have been
+// consumed up to and including it.
+//
+// An error is returned if an abbreviation is ambiguous. The words up to
+// that point are still returned.
+func (c *CLI) expandSubcommand(words []string) ([]string, []int, error) {
+	result := make([]string, 0, len(words))
+	consumed := make([]int, 0, len(words))
+	for i, w := range words {
+		parent := strings.Join(result, " ")
+		key := strings.Join(append(result[:len(result):len(result)], w), " ")
+
+		// Real commands always take precedence over aliases and
+		// abbreviations.
+		if _, ok := c.commandTree.Get(key); ok {
+			result = append(result, w)
+			consumed = append(consumed, i+1)
+			continue
+		}
+
+		if target, ok := c.commandAliases[key]; ok {
+			// The target is always a full command name so it replaces
+			// everything we've seen so far.
+			result = strings.Fields(target)
+			consumed = consumed[:0]
+			for range result {
+				consumed = append(consumed, i+1)
+			}
+
+			continue
+		}
+
+		if c.Abbreviations {
+			candidates := c.abbreviationCandidates(parent, w)
+			if len(candidates) > 1 {
+				return result, consumed, &ambiguousCommandError{
+					Name:       w,
+					Parent:     parent,
+					Candidates: candidates,
+				}
+			}
+
+			if len(candidates) == 1 {
+				w = candidates[0]
+			}
+		}
+
+		result = append(result, w)
+		consumed = append(consumed, i+1)
+	}
+
+	return result, consumed, nil
+}
+
+// abbreviationCandidates returns the names of the visible commands
+// directly underneath parent that start with the given prefix.
+func (c *CLI) abbreviationCandidates(parent, prefix string) []string {
+	var result []string
+	for k := range c.helpCommands(parent, false) {
+		if idx := strings.LastIndex(k, " "); idx > -1 {
+			k = k[idx+1:]
+		}
+
+		if k != "" && strings.HasPrefix(k, prefix) {
+			result = append(result, k)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// ambiguousCommandError is returned when an abbreviated subcommand matches
+// more than one command.
+type ambiguousCommandError struct {
+	Name       string
+	Parent     string
+	Candidates []string
+}
+
+func (e *ambiguousCommandError) Error() string {
+	return fmt.Sprintf(
+		"Ambiguous command '%s'. It could be one of these:\n    %s",
+		e.Name, strings.Join(e.Candidates, "\n    "))
+}
+
+func (inv *Invocation) processArgs() {
+	c := inv.cli
+	skip := 0
+	all := false
+	for i, arg := range inv.args {
+		// Skip the values of global flags that we already consumed.
+		if skip > 0 {
+			skip--
+			continue
+		}
+
 		if arg == "--" {
 			break
 		}
 
+		// Check for the JSON help flag if it is enabled.
+		if c.HelpJSON && (arg == "-help-json" || arg == "--help-json") {
+			inv.isHelpJSON = true
+			continue
+		}
+
 		// Check for help flags.
 		if arg == "-h" || arg == "-help" || arg == "--help" {
-			c.isHelp = true
+			inv.isHelp = true
 			continue
 		}
 
+		// Note the flag that shows all commands in the help output. It is
+		// only special if the help flag is given too, so we keep going.
+		if arg == "-all" || arg == "--all" {
+			all = true
+		}
+
 		// Check for autocomplete flags
 		if c.Autocomplete {
 			if arg == "-"+c.AutocompleteInstall || arg == "--"+c.AutocompleteInstall {
-				c.isAutocompleteInstall = true
+				inv.isAutocompleteInstall = true
 				continue
 			}
 
 			if arg == "-"+c.AutocompleteUninstall || arg == "--"+c.AutocompleteUninstall {
-				c.isAutocompleteUninstall = true
+				inv.isAutocompleteUninstall = true
+				continue
+			}
+
+			// The shell is the value of the script flag, given either
+			// after an equals sign or as the next argument.
+			if arg == "-"+c.AutocompleteScript || arg == "--"+c.AutocompleteScript {
+				inv.isAutocompleteScript = true
+				if i+1 < len(inv.args) {
+					inv.autocompleteShell = inv.args[i+1]
+					skip = 1
+				}
+
+				continue
+			}
+
+			if p := "-" + c.AutocompleteScript + "="; strings.HasPrefix(arg, p) || strings.HasPrefix(arg, "-"+p) {
+				inv.isAutocompleteScript = true
+				inv.autocompleteShell = arg[strings.IndexRune(arg, '=')+1:]
 				continue
 			}
 		}
 
-		if c.subcommand == "" {
+		if inv.subcommand == "" {
 			// Check for version flags if not in a subcommand.
 			if arg == "-v" || arg == "-version" || arg == "--version" {
-				c.isVersion = true
+				inv.isVersion = true
 				continue
 			}
 
+			// Record the JSON flag of the version now, since the top
+			// flags are given to the default command if there is one.
+			if arg == "-json" || arg == "--json" {
+				inv.isVersionJSON = true
+			}
+
 			if arg != "" && arg[0] == '-' {
+				// If this is a declared global flag then record it, along
+				// with its value if it is given as a separate argument.
+				if f := c.globalFlag(arg); f != nil {
+					inv.globalArgs = append(inv.globalArgs, arg)
+					if !strings.ContainsRune(arg, '=') && !isBoolFlag(f) && i+1 < len(inv.args) {
+						inv.globalArgs = append(inv.globalArgs, inv.args[i+1])
+						skip = 1
+					}
+
+					continue
+				}
+
 				// Record the arg...
-				c.topFlags = append(c.topFlags, arg)
+				inv.topFlags = append(inv.topFlags, arg)
 			}
 		}
 
 		// If we didn't find a subcommand yet and this is the first non-flag
 		// argument, then this is our subcommand.
-		if c.subcommand == "" && arg != "" && arg[0] != '-' {
-			c.subcommand = arg
-			if c.commandNested {
+		if inv.subcommand == "" && arg != "" && arg[0] != '-' {
+			inv.subcommand = arg
+			if !c.commandNested {
+				words, _, err := c.expandSubcommand([]string{arg})
+				if err != nil {
+					inv.subcommandErr = err
+					return
+				}
+
+				inv.subcommand = strings.Join(words, " ")
+			} else {
 				// If the command has a space in it, then it is invalid.
 				// Set a blank command so that it fails.
 				if strings.ContainsRune(arg, ' ') {
-					c.subcommand = ""
+					inv.subcommand = ""
 					return
 				}
 
@@ -685,7 +1658,7 @@ func (c *CLI) processArgs() {
 				// argument with a space is always an argument. A blank
 				// argument is always an argument.
 				j := 0
-				for k, v := range c.Args[i:] {
+				for k, v := range inv.args[i:] {
 					if strings.ContainsRune(v, ' ') || v == "" || v[0] == '-' {
 						break
 					}
@@ -695,7 +1668,15 @@ func (c *CLI) processArgs() {
 
 				// Nested CLI, the subcommand is actually the entire
 				// arg list up to a flag that is still a valid subcommand.
-				searchKey := strings.Join(c.Args[i:j], " ")
+				// Aliases and abbreviations are expanded first so that
+				// they can be matched like any other command.
+				words, consumed, err := c.expandSubcommand(inv.args[i:j])
+				if err != nil {
+					inv.subcommandErr = err
+					return
+				}
+
+				searchKey := strings.Join(words, " ")
 				k, _, ok := c.commandTree.LongestPrefix(searchKey)
 				if ok {
 					// k could be a prefix that doesn't contain the full
@@ -704,36 +1685,80 @@ func (c *CLI) processArgs() {
 					// we look for an ending in a space or an end of string.
 					reVerify := regexp.MustCompile(regexp.QuoteMeta(k) + `( |$)`)
 					if reVerify.MatchString(searchKey) {
-						c.subcommand = k
-						i += strings.Count(k, " ")
+						inv.subcommand = k
+						i += consumed[strings.Count(k, " ")] - 1
 					}
 				}
 			}
 
 			// The remaining args the subcommand arguments
-			c.subcommandArgs = c.Args[i+1:]
+			inv.subcommandArgs = inv.args[i+1:]
 		}
 	}
 
+	inv.isHelpAll = inv.isHelp && all
+
 	// If we never found a subcommand and support a default command, then
 	// switch to using that.
-	if c.subcommand == "" {
-		if _, ok := c.Commands[""]; ok {
-			args := c.topFlags
-			args = append(args, c.subcommandArgs...)
-			c.topFlags = nil
-			c.subcommandArgs = args
+	if inv.subcommand == "" {
+		if _, ok := c.commandTree.Get(""); ok {
+			args := inv.topFlags
+			args = append(args, inv.subcommandArgs...)
+			inv.topFlags = nil
+			inv.subcommandArgs = args
+		}
+	}
+
+	// Insert any default arguments from the environment before the
+	// arguments given on the command line. Completion only looks at the
+	// words that were typed, so it doesn't get them.
+	if c.EnvArgsPrefix != "" && !inv.isComplete {
+		args, err := c.envArgs(inv.subcommand)
+		if err != nil {
+			inv.argsErr = err
+			return
+		}
+
+		if len(args) > 0 {
+			inv.subcommandArgs = append(args, inv.subcommandArgs...)
 		}
 	}
 }
 
-// defaultAutocompleteInstall and defaultAutocompleteUninstall are the
-// default values for the autocomplete install and uninstall flags.
+// globalFlag returns the declared global flag for the given argument, or
+// nil if the argument isn't one.
+func (c *CLI) globalFlag(arg string) *flag.Flag {
+	if c.GlobalFlags == nil {
+		return nil
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+	if idx := strings.IndexRune(name, '='); idx > -1 {
+		name = name[:idx]
+	}
+
+	return c.GlobalFlags.Lookup(name)
+}
+
+// defaultAutocompleteInstall, defaultAutocompleteUninstall and
+// defaultAutocompleteScript are the default values for the autocomplete
+// install, uninstall and script flags.
 const defaultAutocompleteInstall = "autocomplete-install"
 const defaultAutocompleteUninstall = "autocomplete-uninstall"
+const defaultAutocompleteScript = "autocomplete-script"
 
 const defaultHelpTemplate = `
-{{.Help}}{{if gt (len .Subcommands) 0}}
+{{.Help}}{{if .Options}}
+
+Options:
+{{.Options}}{{end}}{{if gt (len .SubcommandCategories) 0}}
+{{- range $category := .SubcommandCategories }}
+
+{{ $category.Name }}:
+{{- range $value := $category.Subcommands }}
+    {{ $value.NameAligned }}    {{ $value.Synopsis }}{{ end }}
+{{- end }}
+{{- else if gt (len .Subcommands) 0}}
 
 Subcommands:
 {{- range $value := .Subcommands }}
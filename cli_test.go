@@ -2,13 +2,17 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"flag"
 	"fmt"
 	"io"
 	"os"
 	"reflect"
+	"runtime"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/posener/complete"
 )
@@ -111,6 +115,313 @@ func TestCLIRun(t *testing.T) {
 	}
 }
 
+func TestCLIRun_context(t *testing.T) {
+	type ctxKey struct{}
+
+	command := &MockCommandContext{MockCommand: MockCommand{RunResult: 42}}
+	cli := &CLI{
+		Args: []string{"foo", "-bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		Context: context.WithValue(context.Background(), ctxKey{}, "yes"),
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled || !command.RunContextCalled {
+		t.Fatalf("RunContext should be called instead of Run")
+	}
+
+	if command.RunContextCtx.Value(ctxKey{}) != "yes" {
+		t.Fatalf("context should derive from CLI.Context")
+	}
+
+	if command.RunContextCtx.Err() == nil {
+		t.Fatalf("context should be cancelled once the command returns")
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"-bar"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_contextInterrupt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending interrupts is not supported on Windows")
+	}
+
+	testCases := []struct {
+		name        string
+		gracePeriod time.Duration
+		signals     int
+		exit        bool
+	}{
+		{"cancel", 0, 1, false},
+		{"second signal", 0, 2, true},
+		{"grace period", 10 * time.Millisecond, 1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exitCh := make(chan int, 1)
+			command := &testContextCommand{
+				RunFunc: func(ctx context.Context, args []string) int {
+					testSignal(t)
+					select {
+					case <-ctx.Done():
+					case <-time.After(5 * time.Second):
+						t.Error("context was not cancelled")
+						return 1
+					}
+
+					if !tc.exit {
+						return 42
+					}
+
+					for i := 1; i < tc.signals; i++ {
+						testSignal(t)
+					}
+
+					select {
+					case <-exitCh:
+					case <-time.After(5 * time.Second):
+						t.Error("exit was not called")
+					}
+
+					return 1
+				},
+			}
+
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Args: []string{"foo"},
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						return command, nil
+					},
+				},
+				InterruptGracePeriod: tc.gracePeriod,
+				ErrorWriter:          buf,
+				exitFunc:             func(code int) { exitCh <- code },
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !tc.exit && exitCode != 42 {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			if tc.exit != strings.Contains(buf.String(), "Exiting immediately") {
+				t.Fatalf("bad output: %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestCLIRun_contextInterruptAsk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending interrupts is not supported on Windows")
+	}
+
+	r, w := io.Pipe()
+	defer w.Close()
+
+	exitCh := make(chan int, 1)
+	ui := &BasicUi{Reader: r, Writer: new(bytes.Buffer)}
+	command := &testContextCommand{
+		RunFunc: func(ctx context.Context, args []string) int {
+			// An interrupt at a prompt only aborts the prompt, even twice
+			for i := 0; i < 2; i++ {
+				go testPromptSignal(t)
+				if _, err := ui.Ask("Name?"); err != errInterrupted {
+					t.Errorf("bad: %v", err)
+					return 1
+				}
+			}
+
+			if ctx.Err() != nil {
+				t.Error("context should not be cancelled")
+				return 1
+			}
+
+			return 42
+		},
+	}
+
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		exitFunc: func(code int) { exitCh <- code },
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	select {
+	case <-exitCh:
+		t.Fatal("exit should not be called")
+	default:
+	}
+}
+
+func TestCLIRun_middleware(t *testing.T) {
+	var calls []string
+	record := func(id string) func(RunFunc) RunFunc {
+		return func(next RunFunc) RunFunc {
+			return func(name string, args []string, command Command) int {
+				calls = append(calls, fmt.Sprintf("%s %s %v", id, name, args))
+				return next(name, append(args, id), command)
+			}
+		}
+	}
+
+	command := &MockCommand{RunResult: 42}
+	cli := &CLI{
+		Args: []string{"foo", "bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		Middleware: []func(RunFunc) RunFunc{record("a"), record("b")},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	expected := []string{"a foo [bar]", "b foo [bar a]"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("bad calls: %#v", calls)
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"bar", "a", "b"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_middlewareSpecial(t *testing.T) {
+	testCases := []struct {
+		args      []string
+		result    int
+		exitCode  int
+		name      string
+		isCommand bool
+	}{
+		{[]string{"-v"}, 0, 0, "", false},
+		{[]string{"-h"}, 0, 0, "", false},
+		{[]string{"foo", "-h"}, 0, 0, "foo", true},
+		{[]string{"foo"}, RunResultHelp, 1, "foo", true},
+	}
+
+	for _, testCase := range testCases {
+		var called bool
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args:    testCase.args,
+			Version: "1.0.0",
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return &MockCommand{HelpText: "donuts", RunResult: testCase.result}, nil
+				},
+			},
+			Middleware: []func(RunFunc) RunFunc{
+				func(next RunFunc) RunFunc {
+					return func(name string, args []string, command Command) int {
+						called = true
+						if name != testCase.name {
+							t.Errorf("Args: %#v. Bad name: %q", testCase.args, name)
+						}
+						if (command != nil) != testCase.isCommand {
+							t.Errorf("Args: %#v. Bad command: %#v", testCase.args, command)
+						}
+
+						return next(name, args, command)
+					}
+				},
+			},
+			HelpWriter: buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != testCase.exitCode {
+			t.Errorf("Args: %#v. Code: %d", testCase.args, exitCode)
+		}
+
+		if !called {
+			t.Errorf("Args: %#v. Middleware should be called", testCase.args)
+		}
+
+		if buf.Len() == 0 {
+			t.Errorf("Args: %#v. Output should not be empty", testCase.args)
+		}
+	}
+}
+
+func TestCLIRun_middlewareShortCircuit(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		Middleware: []func(RunFunc) RunFunc{
+			func(next RunFunc) RunFunc {
+				return func(string, []string, Command) int {
+					return 3
+				}
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 3 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatalf("run should not be called")
+	}
+}
+
 func TestCLIRun_blank(t *testing.T) {
 	command := new(MockCommand)
 	cli := &CLI{
@@ -617,63 +928,122 @@ func TestCLIRun_printHelpIllegal(t *testing.T) {
 	}
 }
 
-func TestCLIRun_printCommandHelp(t *testing.T) {
-	testCases := [][]string{
-		{"--help", "foo"},
-		{"-h", "foo"},
+func TestCLIRun_suggestions(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		distance int
+		expected string
+	}{
+		{[]string{"aplly"}, 0, "Unknown command 'aplly'. Did you mean 'apply'?\n\n"},
+		{[]string{"stat"}, 0, "Unknown command 'stat'. Did you mean one of these?\n    state\n    status\n\n"},
+		{[]string{"sekret"}, 0, ""},
+		{[]string{"destroy"}, 0, ""},
+		{[]string{"aplly"}, -1, ""},
+		{[]string{"aplyy"}, 1, ""},
+		{[]string{"state", "shwo"}, 0, "Unknown command 'shwo'. Did you mean 'show'?\n\n"},
 	}
 
-	for _, args := range testCases {
-		command := &MockCommand{
-			HelpText: "donuts",
-		}
-
+	for _, testCase := range testCases {
 		buf := new(bytes.Buffer)
 		cli := &CLI{
-			Args: args,
+			Args: testCase.args,
 			Commands: map[string]CommandFactory{
-				"foo": func() (Command, error) {
-					return command, nil
+				"apply": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"status": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"secret": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"state show": func() (Command, error) {
+					return new(MockCommand), nil
 				},
 			},
-			HelpWriter: buf,
+			HiddenCommands:  []string{"secret"},
+			SuggestDistance: testCase.distance,
+			HelpFunc: func(map[string]CommandFactory) string {
+				return "help"
+			},
+			ErrorWriter: buf,
 		}
 
-		exitCode, err := cli.Run()
-		if err != nil {
+		if _, err := cli.Run(); err != nil {
 			t.Fatalf("err: %s", err)
 		}
 
-		if exitCode != 0 {
-			t.Fatalf("bad exit code: %d", exitCode)
+		if !strings.HasPrefix(buf.String(), testCase.expected) {
+			t.Errorf("Args: %#v. Expected prefix %q, got %q",
+				testCase.args, testCase.expected, buf.String())
 		}
 
-		if buf.String() != (command.HelpText + "\n") {
-			t.Fatalf("bad: %#v", buf.String())
+		if testCase.expected == "" && strings.Contains(buf.String(), "Unknown command") {
+			t.Errorf("Args: %#v. Should not suggest: %q", testCase.args, buf.String())
 		}
 	}
 }
 
-func TestCLIRun_printCommandHelpNested(t *testing.T) {
-	testCases := [][]string{
-		{"--help", "foo", "bar"},
-		{"-h", "foo", "bar"},
+func TestCLIRun_suggestFunc(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"stauts"},
+		Commands: map[string]CommandFactory{
+			"status": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		SuggestFunc: func(unknown string, suggestions []string) string {
+			return fmt.Sprintf("%s? %s!", unknown, strings.Join(suggestions, ","))
+		},
+		HelpFunc: func(map[string]CommandFactory) string {
+			return "help"
+		},
+		ErrorWriter: buf,
 	}
 
-	for _, args := range testCases {
-		command := &MockCommand{
-			HelpText: "donuts",
-		}
+	code, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		buf := new(bytes.Buffer)
+	if code != 127 {
+		t.Fatalf("bad exit code: %d", code)
+	}
+
+	if expected := "stauts? status!\n\nhelp\n"; buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestCLIRun_globalFlags(t *testing.T) {
+	testCases := []struct {
+		args    []string
+		chdir   string
+		noColor bool
+		runArgs []string
+	}{
+		{[]string{"foo"}, "", false, []string{}},
+		{[]string{"-chdir=dir", "foo", "-x"}, "dir", false, []string{"-x"}},
+		{[]string{"-chdir", "dir", "-no-color", "foo", "-chdir=x"}, "dir", true, []string{"-chdir=x"}},
+		{[]string{"--no-color", "foo", "--", "-x"}, "", true, []string{"--", "-x"}},
+	}
+
+	for _, testCase := range testCases {
+		var chdirInFactory string
+		command := new(MockCommand)
+		flags := flag.NewFlagSet("global", flag.ContinueOnError)
+		chdir := flags.String("chdir", "", "Switch to a different `DIR`.")
+		noColor := flags.Bool("no-color", false, "Disable color output.")
 		cli := &CLI{
-			Args: args,
+			Args: testCase.args,
 			Commands: map[string]CommandFactory{
-				"foo bar": func() (Command, error) {
+				"foo": func() (Command, error) {
+					chdirInFactory = *chdir
 					return command, nil
 				},
 			},
-			HelpWriter: buf,
+			GlobalFlags: flags,
 		}
 
 		exitCode, err := cli.Run()
@@ -682,26 +1052,298 @@ func TestCLIRun_printCommandHelpNested(t *testing.T) {
 		}
 
 		if exitCode != 0 {
-			t.Fatalf("bad exit code: %d", exitCode)
+			t.Errorf("Args: %#v. Code: %d", testCase.args, exitCode)
 		}
 
-		if buf.String() != (command.HelpText + "\n") {
-			t.Fatalf("bad: %#v", buf.String())
+		if chdirInFactory != testCase.chdir || *noColor != testCase.noColor {
+			t.Errorf("Args: %#v. Bad flags: %q, %v", testCase.args, chdirInFactory, *noColor)
+		}
+
+		if !reflect.DeepEqual(command.RunArgs, testCase.runArgs) {
+			t.Errorf("Args: %#v. Bad args: %#v", testCase.args, command.RunArgs)
 		}
 	}
 }
 
-func TestCLIRun_printCommandHelpSubcommands(t *testing.T) {
-	testCases := [][]string{
-		{"--help", "foo"},
-		{"-h", "foo"},
+func TestCLIRun_globalFlagsInvalid(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-bad", "foo"}, "Invalid flags before the subcommand."},
+		{[]string{"-level=high", "foo"}, "Error parsing global flags: invalid value"},
 	}
 
-	for _, args := range testCases {
-		command := &MockCommand{
-			HelpText: "donuts",
-		}
-
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := new(MockCommand)
+		flags := flag.NewFlagSet("global", flag.ContinueOnError)
+		flags.Int("level", 0, "Log level.")
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			GlobalFlags: flags,
+			ErrorWriter: buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != 1 {
+			t.Errorf("Args: %#v. Code: %d", testCase.args, exitCode)
+		}
+
+		if command.RunCalled {
+			t.Errorf("Args: %#v. Run should not be called", testCase.args)
+		}
+
+		if !strings.HasPrefix(buf.String(), testCase.expected) {
+			t.Errorf("Args: %#v. Bad output: %q", testCase.args, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_printHelpGlobalFlags(t *testing.T) {
+	buf := new(bytes.Buffer)
+	flags := flag.NewFlagSet("global", flag.ContinueOnError)
+	flags.String("chdir", "", "Switch to a different `DIR`.")
+	flags.Bool("no-color", false, "Disable color output.")
+	flags.String("log-level", "info", "The log level.")
+	cli := &CLI{
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		GlobalFlags: flags,
+		HelpWriter:  buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	expected := `Usage: app [--version] [--help] <command> [<args>]
+
+Available commands are:
+    foo    hi!
+
+Global options:
+    -chdir=DIR           Switch to a different DIR.
+    -log-level=string    The log level. (default: info)
+    -no-color            Disable color output.
+
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v\n\n'%#v'", buf.String(), expected)
+	}
+}
+
+func TestCLIRun_commandFlags(t *testing.T) {
+	flags := flag.NewFlagSet("foo", flag.ContinueOnError)
+	name := flags.String("name", "", "")
+	force := flags.Bool("force", false, "")
+
+	command := &MockCommandFlags{FlagsValue: flags}
+	cli := &CLI{
+		Args: []string{"foo", "-name=bar", "-force", "baz", "-qux"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if *name != "bar" || !*force {
+		t.Fatalf("bad flags: %q %v", *name, *force)
+	}
+
+	if !reflect.DeepEqual(command.RunArgs, []string{"baz", "-qux"}) {
+		t.Fatalf("bad args: %#v", command.RunArgs)
+	}
+}
+
+func TestCLIRun_commandFlagsInvalid(t *testing.T) {
+	flags := flag.NewFlagSet("foo", flag.ContinueOnError)
+	flags.Int("count", 0, "The number of donuts.")
+
+	buf := new(bytes.Buffer)
+	command := &MockCommandFlags{
+		MockCommand: MockCommand{HelpText: "donuts"},
+		FlagsValue:  flags,
+	}
+	cli := &CLI{
+		Args: []string{"foo", "-count=many"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		ErrorWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatalf("run should not be called")
+	}
+
+	expected := "Error parsing command-line flags: invalid value \"many\" for flag -count: parse error\n\n" +
+		"donuts\n\nOptions:\n    -count=int    The number of donuts.\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestCLIRun_printCommandHelpFlags(t *testing.T) {
+	flags := flag.NewFlagSet("foo", flag.ContinueOnError)
+	flags.Bool("force", false, "Don't ask for confirmation.")
+	flags.String("name", "", "The `NAME` of the donut.")
+
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo", "-h"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommandFlags{
+					MockCommand: MockCommand{HelpText: "donuts"},
+					FlagsValue:  flags,
+				}, nil
+			},
+			"foo bar": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		HelpWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if buf.String() != testCommandHelpFlagsOutput {
+		t.Fatalf("bad: %#v\n\n%#v", buf.String(), testCommandHelpFlagsOutput)
+	}
+}
+
+func TestCLIRun_printCommandHelp(t *testing.T) {
+	testCases := [][]string{
+		{"--help", "foo"},
+		{"-h", "foo"},
+	}
+
+	for _, args := range testCases {
+		command := &MockCommand{
+			HelpText: "donuts",
+		}
+
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return command, nil
+				},
+			},
+			HelpWriter: buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != 0 {
+			t.Fatalf("bad exit code: %d", exitCode)
+		}
+
+		if buf.String() != (command.HelpText + "\n") {
+			t.Fatalf("bad: %#v", buf.String())
+		}
+	}
+}
+
+func TestCLIRun_printCommandHelpNested(t *testing.T) {
+	testCases := [][]string{
+		{"--help", "foo", "bar"},
+		{"-h", "foo", "bar"},
+	}
+
+	for _, args := range testCases {
+		command := &MockCommand{
+			HelpText: "donuts",
+		}
+
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: args,
+			Commands: map[string]CommandFactory{
+				"foo bar": func() (Command, error) {
+					return command, nil
+				},
+			},
+			HelpWriter: buf,
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != 0 {
+			t.Fatalf("bad exit code: %d", exitCode)
+		}
+
+		if buf.String() != (command.HelpText + "\n") {
+			t.Fatalf("bad: %#v", buf.String())
+		}
+	}
+}
+
+func TestCLIRun_printCommandHelpSubcommands(t *testing.T) {
+	testCases := [][]string{
+		{"--help", "foo"},
+		{"-h", "foo"},
+	}
+
+	for _, args := range testCases {
+		command := &MockCommand{
+			HelpText: "donuts",
+		}
+
 		buf := new(bytes.Buffer)
 		cli := &CLI{
 			Args: args,
@@ -1076,40 +1718,136 @@ func TestCLIRun_autocompleteUninstall(t *testing.T) {
 	}
 }
 
-func TestCLIRun_autocompleteNoName(t *testing.T) {
-	command := new(MockCommand)
-	installer := new(mockAutocompleteInstaller)
-	cli := &CLI{
-		Args: []string{"foo"},
-		Commands: map[string]CommandFactory{
-			"foo": func() (Command, error) {
-				return command, nil
-			},
-		},
-
-		Autocomplete:          true,
-		autocompleteInstaller: installer,
+func TestCLIRun_autocompleteScript(t *testing.T) {
+	cases := []struct {
+		Args     []string
+		Contains string
+	}{
+		{[]string{"-" + defaultAutocompleteScript + "=bash"}, "complete -C foo foo\n"},
+		{[]string{"--" + defaultAutocompleteScript + "=zsh"}, "out=$(foo __complete \"${(@)words[2,$CURRENT]}\" 2>/dev/null)\n"},
+		{[]string{"-" + defaultAutocompleteScript, "fish"}, "set -l lines (foo __complete $args $current 2>/dev/null)\n"},
+		{[]string{"-" + defaultAutocompleteScript, "fish"}, "complete -c foo -f -a \"(__foo_complete)\"\n"},
+		{[]string{"-" + defaultAutocompleteScript, "PowerShell"}, "-CommandName 'foo'"},
 	}
 
-	exitCode, err := cli.Run()
-	if err == nil {
-		t.Fatal("should error")
-	}
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			command := new(MockCommand)
+			installer := new(mockAutocompleteInstaller)
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Args: tc.Args,
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						return command, nil
+					},
+				},
 
-	if exitCode != 1 {
-		t.Fatalf("bad: %d", exitCode)
-	}
+				Name:                  "foo",
+				Autocomplete:          true,
+				autocompleteInstaller: installer,
+				autocompleteWriter:    buf,
+			}
 
-	if command.RunCalled {
-		t.Fatalf("run should not be called")
-	}
-}
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
 
-// Test that running `-autocomplete-install<tab>` doesn't execute
-// the autocomplete installer. This was a bug reported by Nomad.
-func TestCLIRun_autocompleteInstallTab(t *testing.T) {
-	command := new(MockCommand)
-	installer := new(mockAutocompleteInstaller)
+			if exitCode != 0 {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			if command.RunCalled {
+				t.Fatalf("run should not be called")
+			}
+
+			if installer.InstallCalled || installer.UninstallCalled {
+				t.Fatal("should not install or uninstall")
+			}
+
+			if !strings.Contains(buf.String(), tc.Contains) {
+				t.Fatalf("bad: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestCLIRun_autocompleteScriptInvalid(t *testing.T) {
+	cases := [][]string{
+		{"-" + defaultAutocompleteScript + "=tcsh"},
+		{"-" + defaultAutocompleteScript},
+		{"-" + defaultAutocompleteScript + "=bash", "-" + defaultAutocompleteInstall},
+	}
+
+	for _, args := range cases {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			installer := new(mockAutocompleteInstaller)
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Args: args,
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						return new(MockCommand), nil
+					},
+				},
+
+				Name:                  "foo",
+				Autocomplete:          true,
+				autocompleteInstaller: installer,
+				autocompleteWriter:    buf,
+			}
+
+			exitCode, err := cli.Run()
+			if err == nil {
+				t.Fatal("should error")
+			}
+
+			if exitCode != 1 {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			if installer.InstallCalled || buf.Len() > 0 {
+				t.Fatal("should do nothing")
+			}
+		})
+	}
+}
+
+func TestCLIRun_autocompleteNoName(t *testing.T) {
+	command := new(MockCommand)
+	installer := new(mockAutocompleteInstaller)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+
+		Autocomplete:          true,
+		autocompleteInstaller: installer,
+	}
+
+	exitCode, err := cli.Run()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if command.RunCalled {
+		t.Fatalf("run should not be called")
+	}
+}
+
+// Test that running `-autocomplete-install<tab>` doesn't execute
+// the autocomplete installer. This was a bug reported by Nomad.
+func TestCLIRun_autocompleteInstallTab(t *testing.T) {
+	command := new(MockCommand)
+	installer := new(mockAutocompleteInstaller)
 	cli := &CLI{
 		Args: []string{
 			"-" + defaultAutocompleteInstall,
@@ -1195,6 +1933,7 @@ func TestCLIAutocomplete_root(t *testing.T) {
 		{nil, "-h", []string{"-help"}},
 		{nil, "-a", []string{
 			"-" + defaultAutocompleteInstall,
+			"-" + defaultAutocompleteScript,
 			"-" + defaultAutocompleteUninstall,
 		}},
 
@@ -1365,6 +2104,47 @@ func TestCLIAutocomplete_rootGlobalFlags(t *testing.T) {
 	}
 }
 
+func TestCLIAutocomplete_declaredGlobalFlags(t *testing.T) {
+	flags := flag.NewFlagSet("global", flag.ContinueOnError)
+	flags.String("chdir", "", "")
+	flags.Bool("no-color", false, "")
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) { return new(MockCommand), nil },
+		},
+
+		Autocomplete: true,
+		AutocompleteGlobalFlags: map[string]complete.Predictor{
+			"-chdir": complete.PredictDirs("*"),
+			"-tubes": complete.PredictNothing,
+		},
+		GlobalFlags: flags,
+	}
+
+	// We need to initialize the autocomplete environment so that
+	// the cli doesn't no-op the autocomplete init
+	defer testAutocomplete(t, "must be non-empty")()
+
+	// Initialize
+	cli.init()
+
+	var actual []string
+	for k := range cli.autocomplete.Command.GlobalFlags {
+		actual = append(actual, k)
+	}
+	sort.Strings(actual)
+
+	expected := []string{"-chdir", "-no-color", "-tubes"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if _, ok := cli.autocomplete.Command.GlobalFlags["-chdir"].(complete.PredictFunc); !ok {
+		t.Fatalf("explicit predictor should win: %#v", cli.autocomplete.Command.GlobalFlags["-chdir"])
+	}
+}
+
 func TestCLIAutocomplete_rootDisableDefaultFlags(t *testing.T) {
 	cases := []struct {
 		Completed []string
@@ -1497,6 +2277,41 @@ func TestCLIAutocomplete_subcommandArgs(t *testing.T) {
 	}
 }
 
+func TestCLIAutocomplete_commandFlags(t *testing.T) {
+	flags := flag.NewFlagSet("foo", flag.ContinueOnError)
+	flags.Bool("force", false, "")
+	flags.String("name", "", "")
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommandFlags{FlagsValue: flags}, nil
+			},
+		},
+
+		Autocomplete: true,
+	}
+
+	// We need to initialize the autocomplete environment so that
+	// the cli doesn't no-op the autocomplete init
+	defer testAutocomplete(t, "must be non-empty")()
+
+	// Initialize
+	cli.init()
+
+	actual := cli.autocomplete.Command.Predict(complete.Args{
+		Completed:     []string{"foo"},
+		Last:          "-",
+		LastCompleted: "foo",
+	})
+	sort.Strings(actual)
+
+	expected := []string{"-force", "-name"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad prediction: %#v", actual)
+	}
+}
+
 func TestCLISubcommand(t *testing.T) {
 	testCases := []struct {
 		args       []string
@@ -1551,6 +2366,542 @@ func TestCLISubcommand_nested(t *testing.T) {
 	}
 }
 
+func TestCLISubcommand_aliases(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		subcommand string
+		subArgs    []string
+	}{
+		{[]string{"ls"}, "list", []string{}},
+		{[]string{"ls", "-a"}, "list", []string{"-a"}},
+		{[]string{"st", "foo"}, "state show", []string{"foo"}},
+		{[]string{"state", "ls", "foo"}, "state list", []string{"foo"}},
+		{[]string{"sl", "foo"}, "state list", []string{"foo"}},
+		{[]string{"-h", "rm"}, "delete", []string{}},
+		{[]string{"state", "show"}, "state show", []string{}},
+		{[]string{"ls2"}, "ls2", []string{}},
+	}
+
+	for _, testCase := range testCases {
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"list":       func() (Command, error) { return new(MockCommand), nil },
+				"delete":     func() (Command, error) { return new(MockCommand), nil },
+				"state list": func() (Command, error) { return new(MockCommand), nil },
+				"state show": func() (Command, error) { return new(MockCommand), nil },
+			},
+			Aliases: map[string]string{
+				"ls":       "list",
+				"rm":       "delete",
+				"st":       "state show",
+				"state ls": "state list",
+				"sl":       "state ls",
+			},
+		}
+
+		if result := cli.Subcommand(); result != testCase.subcommand {
+			t.Errorf("Expected %#v, got %#v. Args: %#v",
+				testCase.subcommand, result, testCase.args)
+		}
+
+		if result := cli.SubcommandArgs(); !reflect.DeepEqual(result, testCase.subArgs) {
+			t.Errorf("Expected %#v, got %#v. Args: %#v",
+				testCase.subArgs, result, testCase.args)
+		}
+	}
+}
+
+func TestCLISubcommand_abbreviations(t *testing.T) {
+	testCases := []struct {
+		args       []string
+		subcommand string
+		subArgs    []string
+	}{
+		{[]string{"ap"}, "apply", []string{}},
+		{[]string{"state", "sh", "foo"}, "state show", []string{"foo"}},
+		{[]string{"pk", "in"}, "pkg install", []string{}},
+		{[]string{"statu", "l"}, "status", []string{"l"}},
+		{[]string{"state", "l", "-h"}, "state list", []string{"-h"}},
+		{[]string{"se"}, "se", []string{}},
+		{[]string{"state"}, "state", []string{}},
+		{[]string{"ls"}, "state list", []string{}},
+	}
+
+	for _, testCase := range testCases {
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"apply":       func() (Command, error) { return new(MockCommand), nil },
+				"secret":      func() (Command, error) { return new(MockCommand), nil },
+				"state":       func() (Command, error) { return new(MockCommand), nil },
+				"status":      func() (Command, error) { return new(MockCommand), nil },
+				"state list":  func() (Command, error) { return new(MockCommand), nil },
+				"state show":  func() (Command, error) { return new(MockCommand), nil },
+				"pkg install": func() (Command, error) { return new(MockCommand), nil },
+			},
+			Aliases:        map[string]string{"ls": "state list"},
+			HiddenCommands: []string{"secret"},
+			Abbreviations:  true,
+		}
+
+		if result := cli.Subcommand(); result != testCase.subcommand {
+			t.Errorf("Expected %#v, got %#v. Args: %#v",
+				testCase.subcommand, result, testCase.args)
+		}
+
+		if result := cli.SubcommandArgs(); !reflect.DeepEqual(result, testCase.subArgs) {
+			t.Errorf("Expected %#v, got %#v. Args: %#v",
+				testCase.subArgs, result, testCase.args)
+		}
+	}
+}
+
+func TestCLIRun_abbreviationsAmbiguous(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"st"}, "Ambiguous command 'st'. It could be one of these:\n    start\n    state\n\n"},
+		{[]string{"state", "s", "foo"}, "Ambiguous command 's'. It could be one of these:\n    set\n    show\n\n"},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		command := new(MockCommand)
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"start":      func() (Command, error) { return command, nil },
+				"state set":  func() (Command, error) { return command, nil },
+				"state show": func() (Command, error) { return command, nil },
+			},
+			Abbreviations: true,
+			HelpFunc: func(map[string]CommandFactory) string {
+				return "help"
+			},
+			ErrorWriter: buf,
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != 127 {
+			t.Errorf("Args: %#v. Code: %d", testCase.args, code)
+		}
+
+		if command.RunCalled {
+			t.Errorf("Args: %#v. Run should not be called", testCase.args)
+		}
+
+		if expected := testCase.expected + "help\n"; buf.String() != expected {
+			t.Errorf("Args: %#v. Expected %q, got %q", testCase.args, expected, buf.String())
+		}
+	}
+}
+
+func TestCLISubcommand_aliasInvalid(t *testing.T) {
+	for _, alias := range []string{"loop", "pool", "gone"} {
+		cli := &CLI{
+			Args: []string{alias},
+			Commands: map[string]CommandFactory{
+				"list": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+			Aliases: map[string]string{
+				"ls":   "list",
+				"loop": "pool",
+				"pool": "loop",
+				"gone": "nope",
+			},
+		}
+
+		// The alias is dropped, so it is an unknown command of its own name
+		if result := cli.Subcommand(); result != alias {
+			t.Errorf("Expected %#v, got %#v", alias, result)
+		}
+	}
+}
+
+func TestCLIRun_aliasCommandWins(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"ls"},
+		Commands: map[string]CommandFactory{
+			"ls": func() (Command, error) {
+				return command, nil
+			},
+			"list": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		Aliases: map[string]string{"ls": "list"},
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+}
+
+func TestCLIRun_printHelpAliases(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"delete": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"list": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"hidden": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		Aliases: map[string]string{
+			"ls":     "list",
+			"l":      "list",
+			"secret": "hidden",
+		},
+		HiddenCommands: []string{"hidden"},
+		HelpWriter:     buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	expected := `Usage: app [--version] [--help] <command> [<args>]
+
+Available commands are:
+    delete          hi!
+    list (l, ls)    hi!
+
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: '%#v'\n\n'%#v'", buf.String(), expected)
+	}
+}
+
+func TestCLIRun_printCommandHelpAliases(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"state", "-h"},
+		Commands: map[string]CommandFactory{
+			"state": func() (Command, error) {
+				return &MockCommand{HelpText: "donuts"}, nil
+			},
+			"state list": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"state show": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		Aliases: map[string]string{
+			"state ls": "state list",
+			"st":       "state show",
+		},
+		HelpWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if buf.String() != testCommandHelpSubcommandsAliasesOutput {
+		t.Fatalf("bad: '%#v'\n\n'%#v'", buf.String(), testCommandHelpSubcommandsAliasesOutput)
+	}
+}
+
+func TestCLIRun_printHelpCategories(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"apply": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"plan": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"fmt": func() (Command, error) {
+				return &MockCommandCategory{
+					MockCommand:  MockCommand{SynopsisText: "hi!"},
+					CategoryText: "Other tools",
+				}, nil
+			},
+			"import": func() (Command, error) {
+				return &MockCommandCategory{
+					MockCommand:  MockCommand{SynopsisText: "hi!"},
+					CategoryText: "Other tools",
+				}, nil
+			},
+			"version": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		Categories: map[string]string{
+			"apply":  "Main commands",
+			"plan":   "Main commands",
+			"import": "Advanced commands",
+		},
+		HelpFunc:   CategorizedHelpFunc("foo", []string{"Main commands"}),
+		HelpWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	expected := `Usage: foo [--version] [--help] <command> [<args>]
+
+Main commands:
+    apply      hi!
+    plan       hi!
+
+Advanced commands:
+    import     hi!
+
+Other tools:
+    fmt        hi!
+
+Other commands:
+    version    hi!
+
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: '%#v'\n\n'%#v'", buf.String(), expected)
+	}
+}
+
+func TestCategorizedHelpFunc_uncategorized(t *testing.T) {
+	commands := map[string]CommandFactory{
+		"foo": func() (Command, error) {
+			return &MockCommand{SynopsisText: "hi!"}, nil
+		},
+	}
+
+	actual := CategorizedHelpFunc("foo", nil)(commands)
+	expected := BasicHelpFunc("foo")(commands)
+	if actual != expected {
+		t.Fatalf("bad: '%#v'\n\n'%#v'", actual, expected)
+	}
+}
+
+func TestCLIRun_printHelpCategoryOrderUnwrapped(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		CategoryOrder: []string{"Main commands"},
+		HelpFunc: func(m map[string]CommandFactory) string {
+			command, err := m["foo"]()
+			if err != nil {
+				return err.Error()
+			}
+
+			// Without any aliases or category to add, the HelpFunc gets
+			// the command as the factory created it.
+			if _, ok := command.(*MockCommand); !ok {
+				return fmt.Sprintf("bad type: %T", command)
+			}
+
+			return "ok"
+		},
+		HelpWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if buf.String() != "ok\n" {
+		t.Fatalf("bad: %#v", buf.String())
+	}
+}
+
+func TestCLIRun_printCommandHelpCategories(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"state", "-h"},
+		Commands: map[string]CommandFactory{
+			"state": func() (Command, error) {
+				return &MockCommand{HelpText: "donuts"}, nil
+			},
+			"state list": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"state show": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+			"state replace-provider": func() (Command, error) {
+				return &MockCommandCategory{
+					MockCommand:  MockCommand{SynopsisText: "hi!"},
+					CategoryText: "Modifying state",
+				}, nil
+			},
+			"state rm": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		Categories: map[string]string{
+			"state list": "Inspecting state",
+			"state rm":   "Modifying state",
+		},
+		CategoryOrder: []string{"Inspecting state"},
+		HelpWriter:    buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	if buf.String() != testCommandHelpSubcommandsCategoriesOutput {
+		t.Fatalf("bad: '%#v'\n\n'%#v'", buf.String(), testCommandHelpSubcommandsCategoriesOutput)
+	}
+}
+
+func TestCLIAutocomplete_aliases(t *testing.T) {
+	cases := []struct {
+		Completed []string
+		Last      string
+		Expected  []string
+	}{
+		{nil, "", []string{"list", "ls", "st", "state"}},
+		{[]string{"state"}, "", []string{"list", "ls", "show"}},
+		{[]string{"ls"}, "-", []string{"-all"}},
+		{[]string{"st"}, "-", []string{"-all"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Last, func(t *testing.T) {
+			command := new(MockCommandAutocomplete)
+			command.AutocompleteFlagsValue = map[string]complete.Predictor{
+				"-all": complete.PredictNothing,
+			}
+
+			cli := &CLI{
+				Commands: map[string]CommandFactory{
+					"list":       func() (Command, error) { return command, nil },
+					"hidden":     func() (Command, error) { return command, nil },
+					"state list": func() (Command, error) { return command, nil },
+					"state show": func() (Command, error) { return command, nil },
+				},
+				Aliases: map[string]string{
+					"ls":       "list",
+					"secret":   "hidden",
+					"st":       "state show",
+					"state ls": "state list",
+				},
+				HiddenCommands: []string{"hidden"},
+
+				Autocomplete: true,
+			}
+
+			// We need to initialize the autocomplete environment so that
+			// the cli doesn't no-op the autocomplete init
+			defer testAutocomplete(t, "must be non-empty")()
+
+			// Initialize
+			cli.init()
+
+			// Test the autocompleter
+			args := complete.Args{
+				Completed: tc.Completed,
+				Last:      tc.Last,
+			}
+			if len(tc.Completed) > 0 {
+				args.LastCompleted = tc.Completed[len(tc.Completed)-1]
+			}
+
+			actual := cli.autocomplete.Command.Predict(args)
+			sort.Strings(actual)
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad prediction: %#v", actual)
+			}
+		})
+	}
+}
+
+// testContextCommand is a CommandContext that runs the given function.
+type testContextCommand struct {
+	MockCommand
+
+	RunFunc func(context.Context, []string) int
+}
+
+func (c *testContextCommand) RunContext(ctx context.Context, args []string) int {
+	return c.RunFunc(ctx, args)
+}
+
+// testSignal sends an interrupt to the current process.
+func testSignal(t *testing.T) {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// testPromptSignal sends an interrupt to the current process once a
+// BasicUi is asking.
+func testPromptSignal(t *testing.T) {
+	for {
+		prompts.Lock()
+		waiting := len(prompts.waiting)
+		prompts.Unlock()
+
+		if waiting > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	testSignal(t)
+}
+
 // testAutocomplete sets up the environment to behave like a <tab> was
 // pressed in a shell to autocomplete a command.
 func testAutocomplete(t *testing.T, input string) func() {
@@ -1612,3 +2963,33 @@ Subcommands:
     L2A    hi!
     L2B    hi!
 `
+
+const testCommandHelpSubcommandsAliasesOutput = `donuts
+
+Subcommands:
+    list (ls)    hi!
+    show (st)    hi!
+`
+
+const testCommandHelpSubcommandsCategoriesOutput = `donuts
+
+Inspecting state:
+    list                hi!
+
+Modifying state:
+    replace-provider    hi!
+    rm                  hi!
+
+Other subcommands:
+    show                hi!
+`
+
+const testCommandHelpFlagsOutput = `donuts
+
+Options:
+    -force        Don't ask for confirmation.
+    -name=NAME    The NAME of the donut.
+
+Subcommands:
+    bar    hi!
+`
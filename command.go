@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"context"
+	"flag"
+
 	"github.com/posener/complete"
 )
 
@@ -46,6 +49,63 @@ type CommandAutocomplete interface {
 	AutocompleteFlags() complete.Flags
 }
 
+// CommandCategory is an extension of Command for commands that belong to a
+// category, such as "Common commands". Help output that groups commands,
+// such as CategorizedHelpFunc and the default command help template, lists
+// the command under its category. CLI.Categories takes precedence over
+// this interface.
+type CommandCategory interface {
+	// Category returns the name of the category of the command.
+	Category() string
+}
+
+// CommandContext is an extension of Command for commands that support
+// cancellation. If a command implements CommandContext, the CLI calls
+// RunContext instead of Run.
+//
+// The context is cancelled when the CLI receives an interrupt or
+// termination signal so the command can stop what it is doing and clean
+// up. Commands should not register their own signal handlers. See the
+// CLI docs for details.
+type CommandContext interface {
+	// RunContext is the same as Run, but receives a context that is
+	// cancelled when the command should stop.
+	RunContext(ctx context.Context, args []string) int
+}
+
+// CommandE is an extension of Command for commands that report failure by
+// returning an error. If a command implements CommandE, the CLI calls RunE
+// instead of Run. If a command implements both CommandContext and
+// CommandE, RunContext is called.
+//
+// If RunE returns an error, the CLI prints it to the ErrorWriter and exits
+// with status 1. Return an *ExitError to choose a different exit status or
+// to show the command help after the error.
+type CommandE interface {
+	// RunE is the same as Run, but returns an error instead of an exit
+	// status.
+	RunE(args []string) error
+}
+
+// CommandFlags is an extension of Command for commands that declare their
+// flags with the flag package. If a command implements CommandFlags, the
+// CLI uses the flag set to:
+//
+//   * List the flags in the "Options" section of the command help.
+//
+//   * Autocomplete the flags, unless the command also implements
+//     CommandAutocomplete.
+//
+//   * Parse the arguments before the command is run. Parse errors are
+//     reported along with the command help and Run only receives the
+//     arguments that remain after the flags.
+type CommandFlags interface {
+	// Flags returns the flag set for this command. The values of the flags
+	// should be bound to the command that returns them, since the CLI
+	// parses the arguments with this flag set before running it.
+	Flags() *flag.FlagSet
+}
+
 // CommandHelpTemplate is an extension of Command that also has a function
 // for returning a template for the help rather than the help itself. In
 // this scenario, both Help and HelpTemplate should be implemented.
@@ -56,7 +116,10 @@ type CommandHelpTemplate interface {
 	// displaying the Help. The keys available are:
 	//
 	//   * ".Help" - The help text itself
+	//   * ".Options" - The flags of a CommandFlags implementation
 	//   * ".Subcommands"
+	//   * ".SubcommandCategories" - The subcommands grouped by category,
+	//     if any of them has a category
 	//
 	HelpTemplate() string
 }
@@ -65,3 +128,8 @@ type CommandHelpTemplate interface {
 // We need a factory because we may need to setup some state on the
 // struct that implements the command itself.
 type CommandFactory func() (Command, error)
+
+// RunFunc is a function that runs a command within the CLI and returns the
+// exit status. It receives the name of the resolved subcommand, the
+// arguments for the command and the command itself. See CLI.Middleware.
+type RunFunc func(name string, args []string, command Command) int
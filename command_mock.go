@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"context"
+	"flag"
+
 	"github.com/posener/complete"
 )
 
@@ -50,6 +53,87 @@ func (c *MockCommandAutocomplete) AutocompleteFlags() complete.Flags {
 	return c.AutocompleteFlagsValue
 }
 
+// MockCommandComplete is an implementation of CommandComplete.
+type MockCommandComplete struct {
+	MockCommand
+
+	// Settable
+	CompleteResult    []Completion
+	CompleteDirective CompletionDirective
+
+	// Set by the command
+	CompleteCalled bool
+	CompleteArgs   []string
+	CompleteWord   string
+}
+
+func (c *MockCommandComplete) Complete(args []string, word string) ([]Completion, CompletionDirective) {
+	c.CompleteCalled = true
+	c.CompleteArgs = args
+	c.CompleteWord = word
+
+	return c.CompleteResult, c.CompleteDirective
+}
+
+// MockCommandContext is an implementation of CommandContext.
+type MockCommandContext struct {
+	MockCommand
+
+	// Set by the command
+	RunContextCalled bool
+	RunContextCtx    context.Context
+}
+
+func (c *MockCommandContext) RunContext(ctx context.Context, args []string) int {
+	c.RunContextCalled = true
+	c.RunContextCtx = ctx
+	c.RunArgs = args
+
+	return c.RunResult
+}
+
+// MockCommandE is an implementation of CommandE.
+type MockCommandE struct {
+	MockCommand
+
+	// Settable
+	RunEResult error
+
+	// Set by the command
+	RunECalled bool
+}
+
+func (c *MockCommandE) RunE(args []string) error {
+	c.RunECalled = true
+	c.RunArgs = args
+
+	return c.RunEResult
+}
+
+// MockCommandFlags is an implementation of CommandFlags.
+type MockCommandFlags struct {
+	MockCommand
+
+	// Settable
+	FlagsValue *flag.FlagSet
+}
+
+func (c *MockCommandFlags) Flags() *flag.FlagSet {
+	return c.FlagsValue
+}
+
+// MockCommandCategory is an implementation of CommandCategory.
+type MockCommandCategory struct {
+	MockCommand
+
+	// Settable
+	CategoryText string
+}
+
+func (c *MockCommandCategory) Category() string {
+	return c.CategoryText
+}
+
 // MockCommandHelpTemplate is an implementation of CommandHelpTemplate.
 type MockCommandHelpTemplate struct {
 	MockCommand
@@ -7,3 +7,28 @@ import (
 func TestMockCommand_implements(t *testing.T) {
 	var _ Command = new(MockCommand)
 }
+
+func TestMockCommandContext_implements(t *testing.T) {
+	var _ Command = new(MockCommandContext)
+	var _ CommandContext = new(MockCommandContext)
+}
+
+func TestMockCommandFlags_implements(t *testing.T) {
+	var _ Command = new(MockCommandFlags)
+	var _ CommandFlags = new(MockCommandFlags)
+}
+
+func TestMockCommandCategory_implements(t *testing.T) {
+	var _ Command = new(MockCommandCategory)
+	var _ CommandCategory = new(MockCommandCategory)
+}
+
+func TestMockCommandComplete_implements(t *testing.T) {
+	var _ Command = new(MockCommandComplete)
+	var _ CommandComplete = new(MockCommandComplete)
+}
+
+func TestMockCommandE_implements(t *testing.T) {
+	var _ Command = new(MockCommandE)
+	var _ CommandE = new(MockCommandE)
+}
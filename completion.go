@@ -0,0 +1,324 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+// completeCommand is the hidden command that prints the completions for
+// the words that follow it. See CLI.Autocomplete.
+const completeCommand = "__complete"
+
+// CompletionDirective tells the shell how to complete beyond the
+// candidates returned by the "__complete" command. It is a bitmask, the
+// zero value CompletionDirectiveDefault lets the shell complete file names
+// as usual.
+type CompletionDirective int
+
+// CompletionDirectiveDefault lets the shell fall back to completing file
+// names if it sees fit.
+const CompletionDirectiveDefault CompletionDirective = 0
+
+const (
+	// CompletionDirectiveNoFileComp tells the shell to not complete file
+	// names, even if there are no candidates.
+	CompletionDirectiveNoFileComp CompletionDirective = 1 << iota
+
+	// CompletionDirectiveFilterFileExt tells the shell to complete file
+	// names with one of the extensions given as the candidates, such as
+	// "json" or "yaml".
+	CompletionDirectiveFilterFileExt
+
+	// CompletionDirectiveFilterDirs tells the shell to only complete
+	// directory names. If there is a candidate, it is the directory to
+	// complete in rather than the current one.
+	CompletionDirectiveFilterDirs
+)
+
+// Completion is a candidate for completing a word along with an optional
+// description that shells such as zsh and fish show next to it.
+type Completion struct {
+	Value       string
+	Description string
+}
+
+// CommandComplete is an extension of Command for commands that complete
+// their arguments through the "__complete" command, which unlike
+// CommandAutocomplete supports descriptions and directives.
+type CommandComplete interface {
+	// Complete returns the candidates for the word being completed, given
+	// the arguments that precede it, and the directive for the shell. The
+	// candidates don't need to be filtered by the word.
+	Complete(args []string, word string) ([]Completion, CompletionDirective)
+}
+
+// isCompleteRequest returns true if the args are a request to the hidden
+// "__complete" command.
+func (c *CLI) isCompleteRequest(args []string) bool {
+	return c.Autocomplete && len(args) > 0 && args[0] == completeCommand
+}
+
+// writeCompletions writes the completions for the word being completed to
+// the autocomplete writer. There is a line for every candidate, with the
+// description after a tab if it has one, and a last line with the
+// directive after a colon. For example:
+//
+//	apply	Builds or changes infrastructure.
+//	plan	Shows changes required by the current configuration.
+//	:1
+//
+// The command is resolved from the words before the one being completed
+// in the same way that the arguments are processed to run it.
+func (inv *Invocation) writeCompletions() int {
+	c := inv.cli
+	completions, directive := inv.completions()
+
+	w := c.autocompleteWriter
+	if w == nil {
+		w = os.Stdout
+	}
+
+	for _, comp := range completions {
+		line := comp.Value
+		if comp.Description != "" {
+			// The description must stay on the line of its candidate
+			desc := strings.Fields(comp.Description)
+			line += "\t" + strings.Join(desc, " ")
+		}
+
+		io.WriteString(w, line+"\n")
+	}
+
+	io.WriteString(w, fmt.Sprintf(":%d\n", directive))
+	return 0
+}
+
+// completions returns the candidates that start with the word being
+// completed and the directive for the shell.
+func (inv *Invocation) completions() ([]Completion, CompletionDirective) {
+	c := inv.cli
+	word := inv.completeWord
+
+	// A command with a spec is completed from the spec, without creating
+	// it.
+	var command Command
+	if raw, ok := c.commandTree.Get(inv.subcommand); ok {
+		if impl, err := c.listFactory(inv.subcommand, raw.(CommandFactory))(); err == nil {
+			command = impl
+		}
+	} else if inv.subcommand != "" {
+		// The command doesn't exist, so there is nothing to complete
+		return nil, CompletionDirectiveNoFileComp
+	}
+
+	var result []Completion
+	directive := CompletionDirectiveDefault
+	if strings.HasPrefix(word, "-") {
+		// Flags are only completed from the flags we know about
+		directive = CompletionDirectiveNoFileComp
+		if inv.subcommand == "" {
+			result = c.rootFlagCompletions()
+		}
+
+		if command != nil {
+			result = append(result, c.flagCompletions(inv.subcommand, command)...)
+		}
+	} else {
+		if len(inv.subcommandArgs) == 0 && (inv.subcommand == "" || c.commandNested) {
+			result = c.subcommandCompletions(inv.subcommand)
+			if len(result) > 0 {
+				directive = CompletionDirectiveNoFileComp
+			}
+		}
+
+		if cc, ok := command.(CommandComplete); ok {
+			comps, d := cc.Complete(inv.subcommandArgs, word)
+			result = append(result, comps...)
+			directive |= d
+
+			// The candidates of file extensions and directories aren't
+			// words to complete, so they aren't filtered.
+			if d&(CompletionDirectiveFilterFileExt|CompletionDirectiveFilterDirs) != 0 {
+				return comps, d
+			}
+		} else if p := c.argsPredictor(inv.subcommand, command); p != nil {
+			args := complete.Args{
+				All:           append(append([]string{}, inv.subcommandArgs...), word),
+				Completed:     inv.subcommandArgs,
+				Last:          word,
+				LastCompleted: "",
+			}
+			if len(inv.subcommandArgs) > 0 {
+				args.LastCompleted = inv.subcommandArgs[len(inv.subcommandArgs)-1]
+			}
+
+			for _, v := range p.Predict(args) {
+				result = append(result, Completion{Value: v})
+			}
+		}
+	}
+
+	// Only keep the candidates for the word, once each
+	filtered := make([]Completion, 0, len(result))
+	seen := make(map[string]struct{}, len(result))
+	for _, comp := range result {
+		if !strings.HasPrefix(comp.Value, word) {
+			continue
+		}
+		if _, ok := seen[comp.Value]; ok {
+			continue
+		}
+
+		seen[comp.Value] = struct{}{}
+		filtered = append(filtered, comp)
+	}
+
+	return filtered, directive
+}
+
+// argsPredictor returns the predictor of the arguments of the command with
+// the given full key, from its spec if it has one.
+func (c *CLI) argsPredictor(k string, command Command) complete.Predictor {
+	if spec, ok := c.commandSpecs[k]; ok {
+		return spec.AutocompleteArgs
+	}
+
+	if ac, ok := command.(CommandAutocomplete); ok {
+		return ac.AutocompleteArgs()
+	}
+
+	return nil
+}
+
+// flagCompletions returns the flags of the command with the given full
+// key, from its spec if it has one.
+func (c *CLI) flagCompletions(k string, command Command) []Completion {
+	if spec, ok := c.commandSpecs[k]; ok {
+		names := make([]string, 0, len(spec.AutocompleteFlags))
+		for f := range spec.AutocompleteFlags {
+			names = append(names, f)
+		}
+		sort.Strings(names)
+
+		result := make([]Completion, len(names))
+		for i, f := range names {
+			result[i] = Completion{Value: f}
+		}
+
+		return result
+	}
+
+	return commandFlagCompletions(command)
+}
+
+// subcommandCompletions returns the visible subcommands and aliases
+// directly underneath parent, described by their synopsis.
+func (c *CLI) subcommandCompletions(parent string) []Completion {
+	prefix := parent
+	if prefix != "" {
+		prefix += " "
+	}
+
+	synopses := make(map[string]string)
+	for k, f := range c.helpCommands(parent, false) {
+		if command, err := f(); err == nil {
+			synopses[k[len(prefix):]] = command.Synopsis()
+		}
+	}
+
+	for alias, target := range c.commandAliases {
+		if !strings.HasPrefix(alias, prefix) || strings.Contains(alias[len(prefix):], " ") {
+			continue
+		}
+
+		if _, ok := c.commandHidden[target]; ok {
+			continue
+		}
+		if _, ok := c.DeprecatedCommands[target]; ok {
+			continue
+		}
+
+		raw, ok := c.commandTree.Get(target)
+		if !ok {
+			continue
+		}
+
+		if command, err := c.listFactory(target, raw.(CommandFactory))(); err == nil {
+			if _, ok := synopses[alias[len(prefix):]]; !ok {
+				synopses[alias[len(prefix):]] = command.Synopsis()
+			}
+		}
+	}
+
+	names := make([]string, 0, len(synopses))
+	for k := range synopses {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	result := make([]Completion, len(names))
+	for i, k := range names {
+		result[i] = Completion{Value: k, Description: synopses[k]}
+	}
+
+	return result
+}
+
+// rootFlagCompletions returns the flags of the CLI itself. Declared global
+// flags are described by their usage.
+func (c *CLI) rootFlagCompletions() []Completion {
+	var usages map[string]string
+	if c.GlobalFlags != nil {
+		usages = flagUsages(c.GlobalFlags)
+	}
+
+	names := c.rootFlagNames()
+	result := make([]Completion, len(names))
+	for i, k := range names {
+		result[i] = Completion{Value: k, Description: usages[k]}
+	}
+
+	return result
+}
+
+// commandFlagCompletions returns the flags of the command. Flags that the
+// command declares with CommandFlags are described by their usage.
+func commandFlagCompletions(command Command) []Completion {
+	var usages map[string]string
+	if cf, ok := command.(CommandFlags); ok {
+		if fs := cf.Flags(); fs != nil {
+			usages = flagUsages(fs)
+		}
+	}
+
+	names := make([]string, 0)
+	for k := range autocompleteFlags(command) {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	result := make([]Completion, len(names))
+	for i, k := range names {
+		result[i] = Completion{Value: k, Description: usages[k]}
+	}
+
+	return result
+}
+
+// flagUsages returns the usage of every flag in fs keyed by the flag with
+// its hyphen, such as "-force".
+func flagUsages(fs *flag.FlagSet) map[string]string {
+	result := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		_, usage := flag.UnquoteUsage(f)
+		result["-"+f.Name] = usage
+	})
+
+	return result
+}
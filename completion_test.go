@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/posener/complete"
+)
+
+func TestCLIRun_complete(t *testing.T) {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	fs.Bool("auto-approve", false, "Skip the\n    interactive approval.")
+	fs.String("var", "", "Set a variable.")
+
+	global := flag.NewFlagSet("global", flag.ContinueOnError)
+	global.String("chdir", "", "Switch to a different directory.")
+
+	cases := []struct {
+		Args     []string
+		Expected string
+	}{
+		{
+			[]string{""},
+			"apply\tBuilds or changes infrastructure.\n" +
+				"ls\tLists resources.\n" +
+				"plan\tShows changes.\n" +
+				"state\n" +
+				":1\n",
+		},
+		{
+			[]string{"p"},
+			"plan\tShows changes.\n:1\n",
+		},
+		{
+			[]string{"-chdir", "foo", "st"},
+			"state\n:1\n",
+		},
+		{
+			[]string{"state", ""},
+			"list\tLists resources.\n:1\n",
+		},
+		{
+			[]string{"apply", "-"},
+			"-auto-approve\tSkip the interactive approval.\n" +
+				"-var\tSet a variable.\n" +
+				":1\n",
+		},
+		{
+			[]string{"-c"},
+			"-chdir\tSwitch to a different directory.\n:1\n",
+		},
+		{
+			[]string{"plan", "d"},
+			"dev\nduck\n:0\n",
+		},
+		{
+			[]string{"nope", "nope", ""},
+			":1\n",
+		},
+		{
+			nil,
+			"apply\tBuilds or changes infrastructure.\n" +
+				"ls\tLists resources.\n" +
+				"plan\tShows changes.\n" +
+				"state\n" +
+				":1\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			command := new(MockCommand)
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Args: append([]string{"__complete"}, tc.Args...),
+				Commands: map[string]CommandFactory{
+					"apply": func() (Command, error) {
+						return &MockCommandFlags{
+							MockCommand: MockCommand{SynopsisText: "Builds or changes infrastructure."},
+							FlagsValue:  fs,
+						}, nil
+					},
+					"plan": func() (Command, error) {
+						return &MockCommandAutocomplete{
+							MockCommand:           MockCommand{SynopsisText: "Shows changes."},
+							AutocompleteArgsValue: complete.PredictSet("dev", "duck", "prod"),
+						}, nil
+					},
+					"state list": func() (Command, error) {
+						return &MockCommand{SynopsisText: "Lists resources."}, nil
+					},
+					"secret": func() (Command, error) {
+						return command, nil
+					},
+				},
+				Aliases: map[string]string{
+					"ls": "state list",
+				},
+				HiddenCommands:     []string{"secret"},
+				GlobalFlags:        global,
+				Name:               "app",
+				Autocomplete:       true,
+				autocompleteWriter: buf,
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != 0 {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			if command.RunCalled {
+				t.Fatalf("run should not be called")
+			}
+
+			if buf.String() != tc.Expected {
+				t.Fatalf("bad: %q\n\nexpected: %q", buf.String(), tc.Expected)
+			}
+		})
+	}
+}
+
+func TestCLIRun_completeCommand(t *testing.T) {
+	cases := []struct {
+		Args      []string
+		Result    []Completion
+		Directive CompletionDirective
+		Expected  string
+	}{
+		{
+			[]string{"foo", "a", "b"},
+			[]Completion{{Value: "bar", Description: "The bar."}, {Value: "baz"}},
+			CompletionDirectiveNoFileComp,
+			"bar\tThe bar.\nbaz\n:1\n",
+		},
+		{
+			[]string{"foo", "a", ""},
+			[]Completion{{Value: "json"}, {Value: "yaml"}},
+			CompletionDirectiveFilterFileExt,
+			"json\nyaml\n:2\n",
+		},
+		{
+			[]string{"foo", "a", ""},
+			nil,
+			CompletionDirectiveFilterDirs | CompletionDirectiveNoFileComp,
+			":5\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Expected, func(t *testing.T) {
+			command := &MockCommandComplete{
+				CompleteResult:    tc.Result,
+				CompleteDirective: tc.Directive,
+			}
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Args: append([]string{"__complete"}, tc.Args...),
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						return command, nil
+					},
+				},
+				Name:               "app",
+				Autocomplete:       true,
+				autocompleteWriter: buf,
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != 0 {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			if command.RunCalled {
+				t.Fatalf("run should not be called")
+			}
+
+			args := tc.Args[1 : len(tc.Args)-1]
+			if !reflect.DeepEqual(command.CompleteArgs, args) {
+				t.Fatalf("bad: %#v", command.CompleteArgs)
+			}
+
+			if command.CompleteWord != tc.Args[len(tc.Args)-1] {
+				t.Fatalf("bad: %q", command.CompleteWord)
+			}
+
+			if buf.String() != tc.Expected {
+				t.Fatalf("bad: %q\n\nexpected: %q", buf.String(), tc.Expected)
+			}
+		})
+	}
+}
+
+func TestCLIRun_completeEnvArgs(t *testing.T) {
+	os.Setenv("APP_CLI_ARGS", "-no-color")
+	defer os.Unsetenv("APP_CLI_ARGS")
+
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"__complete", "state", ""},
+		Commands: map[string]CommandFactory{
+			"state list": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Lists resources."}, nil
+			},
+		},
+		EnvArgsPrefix:      "APP",
+		Name:               "app",
+		Autocomplete:       true,
+		autocompleteWriter: buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	expected := "list\tLists resources.\n:1\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q\n\nexpected: %q", buf.String(), expected)
+	}
+}
+
+func TestCLIRun_completeDisabled(t *testing.T) {
+	command := new(MockCommand)
+	cli := &CLI{
+		Args: []string{"__complete", ""},
+		Commands: map[string]CommandFactory{
+			"__complete": func() (Command, error) {
+				return command, nil
+			},
+		},
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !command.RunCalled {
+		t.Fatal("run should be called")
+	}
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultPanicExitCode is the exit status after a panic if PanicExitCode
+// isn't set. It is EX_SOFTWARE from sysexits.h, an internal software error.
+const defaultPanicExitCode = 70
+
+// recoverPanic recovers from a panic, writes the crash log with the given
+// args and reports it to the user. It must be deferred directly by Run so
+// that it can set the results of Run.
+func (c *CLI) recoverPanic(args []string, exitCode *int, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	// The panic may have happened before the writers were set up
+	w := c.ErrorWriter
+	if w == nil {
+		w = os.Stderr
+	}
+
+	name := c.Name
+	if name == "" {
+		name = "The command"
+	}
+
+	log := c.crashLog(r, args)
+	path, logErr := c.writeCrashLog(log)
+	if logErr != nil {
+		w.Write([]byte(fmt.Sprintf(
+			"\n%s crashed! This is always a bug, please report it.\n"+
+				"Writing the crash log failed: %s\n\n%s", name, logErr, log)))
+	} else {
+		w.Write([]byte(fmt.Sprintf(
+			"\n%s crashed! This is always a bug, please report it and "+
+				"include the crash log at:\n\n    %s\n", name, path)))
+	}
+
+	*exitCode = c.PanicExitCode
+	if *exitCode == 0 {
+		*exitCode = defaultPanicExitCode
+	}
+	*err = nil
+}
+
+// crashLog returns the contents of the crash log for the recovered value
+// and the args that were run.
+func (c *CLI) crashLog(r interface{}, args []string) string {
+	args = append([]string(nil), args...)
+	if c.CrashRedactFunc != nil {
+		args = c.CrashRedactFunc(args)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("Panic: %v\n", r))
+	buf.WriteString(fmt.Sprintf("Time: %s\n", time.Now().UTC().Format(time.RFC3339)))
+	buf.WriteString(fmt.Sprintf("Name: %s\n", c.Name))
+	buf.WriteString(fmt.Sprintf("Version: %s\n", c.Version))
+	buf.WriteString(fmt.Sprintf("Go version: %s\n", runtime.Version()))
+	buf.WriteString(fmt.Sprintf("OS/Arch: %s/%s\n", runtime.GOOS, runtime.GOARCH))
+	buf.WriteString(fmt.Sprintf("Args: %q\n\n", args))
+	buf.WriteString(goroutineStacks())
+
+	return buf.String()
+}
+
+// writeCrashLog writes the crash log to a new file in CrashLogDir and
+// returns its path.
+func (c *CLI) writeCrashLog(log string) (string, error) {
+	dir := c.CrashLogDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	prefix := "crash-"
+	if c.Name != "" {
+		prefix = c.Name + "-crash-"
+	}
+
+	f, err := ioutil.TempFile(dir, prefix+time.Now().UTC().Format("20060102-150405")+"-*.log")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(log); err != nil {
+		return "", err
+	}
+
+	return f.Name(), f.Close()
+}
+
+// goroutineStacks returns the stacks of all the goroutines.
+func goroutineStacks() string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLIRun_recoverPanics(t *testing.T) {
+	cases := map[string]CommandFactory{
+		"factory": func() (Command, error) {
+			panic("factory")
+		},
+		"run": func() (Command, error) {
+			return new(testPanicCommand), nil
+		},
+	}
+
+	for name, f := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cli")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			buf := new(bytes.Buffer)
+			cli := &CLI{
+				Name:    "app",
+				Version: "1.0.0",
+				Args:    []string{"foo", "-token=secret", "bar"},
+				Commands: map[string]CommandFactory{
+					"foo": f,
+				},
+				RecoverPanics: true,
+				CrashLogDir:   dir,
+				CrashRedactFunc: func(args []string) []string {
+					for i, arg := range args {
+						if strings.HasPrefix(arg, "-token=") {
+							args[i] = "-token=REDACTED"
+						}
+					}
+
+					return args
+				},
+				ErrorWriter: buf,
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != defaultPanicExitCode {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			// The original args must not be modified by the redaction
+			if cli.Args[1] != "-token=secret" {
+				t.Fatalf("bad: %#v", cli.Args)
+			}
+
+			matches, err := filepath.Glob(filepath.Join(dir, "app-crash-*.log"))
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if len(matches) != 1 {
+				t.Fatalf("bad: %#v", matches)
+			}
+
+			if !strings.Contains(buf.String(), matches[0]) {
+				t.Fatalf("bad: %s", buf.String())
+			}
+
+			contents, err := ioutil.ReadFile(matches[0])
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			for _, s := range []string{
+				"Panic: " + name + "\n",
+				"Version: 1.0.0\n",
+				"Go version: go",
+				`Args: ["foo" "-token=REDACTED" "bar"]`,
+				"goroutine ",
+			} {
+				if !strings.Contains(string(contents), s) {
+					t.Fatalf("missing %q:\n\n%s", s, contents)
+				}
+			}
+
+			if strings.Contains(string(contents), "secret") {
+				t.Fatalf("bad:\n\n%s", contents)
+			}
+		})
+	}
+}
+
+func TestCLIRun_recoverPanicsExitCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(testPanicCommand), nil
+			},
+		},
+		RecoverPanics: true,
+		CrashLogDir:   dir,
+		PanicExitCode: 3,
+		ErrorWriter:   new(bytes.Buffer),
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 3 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+}
+
+func TestCLIRun_noRecoverPanics(t *testing.T) {
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(testPanicCommand), nil
+			},
+		},
+	}
+
+	defer func() {
+		if r := recover(); r != "run" {
+			t.Fatalf("bad: %#v", r)
+		}
+	}()
+
+	cli.Run()
+	t.Fatal("should panic")
+}
+
+// testPanicCommand is a command that panics when it is run.
+type testPanicCommand struct {
+	MockCommand
+}
+
+func (c *testPanicCommand) Run(args []string) int {
+	panic("run")
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Deprecation describes a deprecated command. See CLI.DeprecatedCommands.
+type Deprecation struct {
+	// Message is an optional message that is shown after the warning,
+	// such as an explanation of why the command is deprecated.
+	Message string
+
+	// Replacement is the optional full name of the command to use instead.
+	Replacement string
+
+	// RemovedIn is the optional version of the CLI in which the command is
+	// removed, such as "2.0.0".
+	RemovedIn string
+}
+
+// warning returns the warning shown when the deprecated command with the
+// given name is run by the given version of the CLI.
+func (d *Deprecation) warning(name, version string) string {
+	msg := fmt.Sprintf("Warning: The %q command is deprecated", name)
+	switch {
+	case d.isRemoved(version):
+		msg += fmt.Sprintf(" and was due to be removed in version %s", d.RemovedIn)
+	case d.RemovedIn != "":
+		msg += fmt.Sprintf(" and will be removed in version %s", d.RemovedIn)
+	}
+
+	return d.finish(msg + ".")
+}
+
+// helpNote returns the note that marks the deprecated command in the help
+// output, such as "(deprecated, use "bar" instead)".
+func (d *Deprecation) helpNote() string {
+	if d.Replacement != "" {
+		return fmt.Sprintf("(deprecated, use %q instead)", d.Replacement)
+	}
+
+	return "(deprecated)"
+}
+
+// removed returns the error shown when the deprecated command with the
+// given name is run once it has been removed.
+func (d *Deprecation) removed(name string) string {
+	return d.finish(fmt.Sprintf(
+		"Error: The %q command was removed in version %s.", name, d.RemovedIn))
+}
+
+// finish adds the replacement and the message to msg.
+func (d *Deprecation) finish(msg string) string {
+	if d.Replacement != "" {
+		msg += fmt.Sprintf(" Use %q instead.", d.Replacement)
+	}
+
+	if d.Message != "" {
+		msg += "\n" + d.Message
+	}
+
+	return msg
+}
+
+// isRemoved returns true if the deprecated command is removed as of the
+// given version of the CLI. If either version can't be parsed, the command
+// is never considered removed.
+func (d *Deprecation) isRemoved(version string) bool {
+	if d.RemovedIn == "" {
+		return false
+	}
+
+	cmp, ok := compareVersions(version, d.RemovedIn)
+	return ok && cmp >= 0
+}
+
+// compareVersions compares two versions of the form "1.2.3", with an
+// optional "v" prefix. Any pre-release or build suffix such as "-beta1" is
+// ignored and missing parts are treated as zero. The result is -1, 0 or 1
+// if a is less than, equal to or greater than b. The second return value
+// is false if either version can't be parsed.
+func compareVersions(a, b string) (int, bool) {
+	va, ok := parseVersion(a)
+	if !ok {
+		return 0, false
+	}
+
+	vb, ok := parseVersion(b)
+	if !ok {
+		return 0, false
+	}
+
+	for len(va) < len(vb) {
+		va = append(va, 0)
+	}
+	for len(vb) < len(va) {
+		vb = append(vb, 0)
+	}
+
+	for i := range va {
+		if va[i] < vb[i] {
+			return -1, true
+		}
+		if va[i] > vb[i] {
+			return 1, true
+		}
+	}
+
+	return 0, true
+}
+
+// parseVersion parses the numeric parts of a version for compareVersions.
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if idx := strings.IndexAny(v, "-+"); idx > -1 {
+		v = v[:idx]
+	}
+
+	if v == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(v, ".")
+	result := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+
+		result[i] = n
+	}
+
+	return result, true
+}
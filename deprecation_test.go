@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		A, B     string
+		Expected int
+		OK       bool
+	}{
+		{"1.0.0", "1.0.0", 0, true},
+		{"v1.0.0", "1.0", 0, true},
+		{"1.2.0", "1.10.0", -1, true},
+		{"2.0.0", "1.10.0", 1, true},
+		{"2.0.0-beta1", "2.0.0", 0, true},
+		{"1.0.0+abc", "1.0.1", -1, true},
+		{"", "1.0.0", 0, false},
+		{"dev", "1.0.0", 0, false},
+		{"1.0.0", "1.x", 0, false},
+	}
+
+	for _, tc := range cases {
+		actual, ok := compareVersions(tc.A, tc.B)
+		if actual != tc.Expected || ok != tc.OK {
+			t.Errorf("%q, %q: expected %d, %v, got %d, %v",
+				tc.A, tc.B, tc.Expected, tc.OK, actual, ok)
+		}
+	}
+}
+
+func TestCLIRun_deprecated(t *testing.T) {
+	testCases := []struct {
+		name      string
+		version   string
+		enforce   bool
+		exitCode  int
+		runCalled bool
+		output    string
+	}{
+		{
+			"warning",
+			"1.0.0",
+			false,
+			42,
+			true,
+			"Warning: The \"foo\" command is deprecated and will be removed in version 2.0.0. Use \"bar\" instead.\nUse bar.\n\n",
+		},
+		{
+			"removed not enforced",
+			"2.0.0",
+			false,
+			42,
+			true,
+			"Warning: The \"foo\" command is deprecated and was due to be removed in version 2.0.0. Use \"bar\" instead.\nUse bar.\n\n",
+		},
+		{
+			"removed not yet",
+			"1.9.9",
+			true,
+			42,
+			true,
+			"Warning: The \"foo\" command is deprecated and will be removed in version 2.0.0. Use \"bar\" instead.\nUse bar.\n\n",
+		},
+		{
+			"removed",
+			"2.0.1",
+			true,
+			1,
+			false,
+			"Error: The \"foo\" command was removed in version 2.0.0. Use \"bar\" instead.\nUse bar.\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			command := &MockCommand{RunResult: 42}
+			cli := &CLI{
+				Args:    []string{"foo"},
+				Version: tc.version,
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) { return command, nil },
+					"bar": func() (Command, error) { return new(MockCommand), nil },
+				},
+				DeprecatedCommands: map[string]Deprecation{
+					"foo": {
+						Message:     "Use bar.",
+						Replacement: "bar",
+						RemovedIn:   "2.0.0",
+					},
+				},
+				EnforceDeprecations: tc.enforce,
+				ErrorWriter:         buf,
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != tc.exitCode {
+				t.Fatalf("bad exit code: %d", exitCode)
+			}
+
+			if command.RunCalled != tc.runCalled {
+				t.Fatalf("bad run called: %v", command.RunCalled)
+			}
+
+			if buf.String() != tc.output {
+				t.Fatalf("bad: %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestCLIRun_deprecatedMinimal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"foo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) { return new(MockCommand), nil },
+		},
+		DeprecatedCommands:  map[string]Deprecation{"foo": {}},
+		EnforceDeprecations: true,
+		ErrorWriter:         buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if expected := "Warning: The \"foo\" command is deprecated.\n\n"; buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+func TestCLIRun_printHelpDeprecated(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"-h"}, []string{"bar"}},
+		{[]string{"-h", "-all"}, []string{"bar", "foo"}},
+		{[]string{"--all", "--help"}, []string{"bar", "foo"}},
+	}
+
+	for _, testCase := range testCases {
+		var keys []string
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"foo":    func() (Command, error) { return new(MockCommand), nil },
+				"bar":    func() (Command, error) { return new(MockCommand), nil },
+				"hidden": func() (Command, error) { return new(MockCommand), nil },
+			},
+			DeprecatedCommands: map[string]Deprecation{"foo": {}},
+			HiddenCommands:     []string{"hidden"},
+			HelpFunc: func(m map[string]CommandFactory) string {
+				keys = nil
+				for k := range m {
+					keys = append(keys, k)
+				}
+
+				return ""
+			},
+			HelpWriter: new(bytes.Buffer),
+		}
+
+		code, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if code != 0 {
+			t.Fatalf("bad exit code: %d", code)
+		}
+
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, testCase.expected) {
+			t.Errorf("Args: %#v. Bad commands: %#v", testCase.args, keys)
+		}
+	}
+}
+
+func TestCLIRun_printHelpDeprecatedMarked(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-h", "-all"}, "    foo      Does foo. (deprecated, use \"bar\" instead)\n"},
+		{[]string{"-h", "-all"}, "    state    (deprecated)\n"},
+		{[]string{"state", "-h", "-all"}, "    old     Does old. (deprecated)\n"},
+	}
+
+	for _, testCase := range testCases {
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args: testCase.args,
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return &MockCommand{SynopsisText: "Does foo."}, nil
+				},
+				"bar": func() (Command, error) {
+					return &MockCommand{SynopsisText: "Does bar."}, nil
+				},
+				"state": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+				"state list": func() (Command, error) {
+					return &MockCommand{SynopsisText: "Does list."}, nil
+				},
+				"state old": func() (Command, error) {
+					return &MockCommand{SynopsisText: "Does old."}, nil
+				},
+			},
+			DeprecatedCommands: map[string]Deprecation{
+				"foo":       {Replacement: "bar"},
+				"state":     {},
+				"state old": {},
+			},
+			HelpWriter: buf,
+		}
+
+		if _, err := cli.Run(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !strings.Contains(buf.String(), testCase.expected) {
+			t.Errorf("Args: %#v. Missing %q in:\n\n%s", testCase.args, testCase.expected, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_suggestionsDeprecated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"fooo"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) { return new(MockCommand), nil },
+		},
+		DeprecatedCommands: map[string]Deprecation{"foo": {}},
+		ErrorWriter:        buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if strings.Contains(buf.String(), "Did you mean") {
+		t.Fatalf("deprecated commands should not be suggested: %q", buf.String())
+	}
+}
+
+func TestCLIAutocomplete_deprecated(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) { return new(MockCommand), nil },
+			"bar": func() (Command, error) { return new(MockCommand), nil },
+		},
+		Aliases:            map[string]string{"f": "foo"},
+		DeprecatedCommands: map[string]Deprecation{"foo": {}},
+
+		Autocomplete: true,
+	}
+
+	// We need to initialize the autocomplete environment so that
+	// the cli doesn't no-op the autocomplete init
+	defer testAutocomplete(t, "must be non-empty")()
+
+	// Initialize
+	cli.init()
+
+	var actual []string
+	for k := range cli.autocomplete.Command.Sub {
+		actual = append(actual, k)
+	}
+
+	if !reflect.DeepEqual(actual, []string{"bar"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
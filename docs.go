@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// DocsFormat is the format of the documentation written by CLI.Docs.
+type DocsFormat int
+
+const (
+	// DocsMarkdown writes the documentation as Markdown files.
+	DocsMarkdown DocsFormat = iota
+
+	// DocsHTML writes the documentation as static HTML files.
+	DocsHTML
+)
+
+// extension returns the file extension of the format, including the dot.
+func (f DocsFormat) extension() string {
+	if f == DocsHTML {
+		return ".html"
+	}
+
+	return ".md"
+}
+
+// Docs writes reference documentation for the CLI into the directory dir,
+// which is created if it doesn't exist.
+//
+// The documentation consists of an index page named "index.md" that links
+// to every visible command, and a page for each visible command. The page
+// for a command such as "foo bar" is named "<Name>-foo-bar.md" and contains
+// breadcrumbs that link to the index and the pages of its parents, its
+// synopsis, help, options and links to the pages of its subcommands. With
+// DocsHTML the same pages are written as HTML files instead.
+//
+// The pages are rendered from the same data as the command help template,
+// see CommandHelpTemplate, so the documentation matches the "-help" output.
+// Hidden commands and the commands underneath them are left out. Name must
+// be set.
+func (c *CLI) Docs(dir string, format DocsFormat) error {
+	c.once.Do(c.init)
+
+	if c.Name == "" {
+		return errors.New("cli: Name must be set to generate docs")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Write the index, which is the page of the CLI itself
+	var buf bytes.Buffer
+	if err := c.writeDocsPage(&buf, format, docsIndexTemplate, c.docsIndexData(format)); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, c.docsFileName("", format))
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	// Write a page for every command
+	for _, k := range c.visibleCommands() {
+		raw, _ := c.commandTree.Get(k)
+		command, err := raw.(CommandFactory)()
+		if err != nil {
+			return fmt.Errorf("cli: command %q failed to load: %s", k, err)
+		}
+
+		buf.Reset()
+		data := c.docsCommandData(k, command, format)
+		if err := c.writeDocsPage(&buf, format, docsCommandTemplate, data); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, c.docsFileName(k, format))
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// docsIndexData returns the template data for the index page.
+func (c *CLI) docsIndexData(format DocsFormat) map[string]interface{} {
+	data := map[string]interface{}{
+		"Name":          c.Name,
+		"Version":       c.Version,
+		"GlobalOptions": "",
+	}
+
+	if c.GlobalFlags != nil {
+		data["GlobalOptions"] = strings.TrimRight(flagsHelp(c.GlobalFlags), "\n")
+	}
+
+	var commands []map[string]interface{}
+	for _, k := range c.visibleCommands() {
+		raw, _ := c.commandTree.Get(k)
+		command, err := raw.(CommandFactory)()
+		if err != nil {
+			continue
+		}
+
+		_, deprecated := c.DeprecatedCommands[k]
+		commands = append(commands, map[string]interface{}{
+			"Name":       k,
+			"Link":       c.docsFileName(k, format),
+			"Synopsis":   strings.TrimSpace(command.Synopsis()),
+			"Deprecated": deprecated,
+		})
+	}
+	data["Commands"] = commands
+
+	return data
+}
+
+// docsCommandData returns the template data for the page of the command
+// with the given full name. It extends the data of the help template with
+// the breadcrumbs and the links to the pages of the subcommands.
+func (c *CLI) docsCommandData(name string, command Command, format DocsFormat) map[string]interface{} {
+	data := c.commandHelpData(name, command, false)
+	data["Title"] = c.Name + " " + name
+	data["Help"] = strings.TrimSpace(command.Help())
+	data["Synopsis"] = strings.TrimSpace(command.Synopsis())
+	data["Deprecation"] = ""
+	if d, ok := c.DeprecatedCommands[name]; ok {
+		data["Deprecation"] = strings.Replace(d.warning(name, c.Version), "\n", " ", -1)
+	}
+
+	words := strings.Split(name, " ")
+	data["Command"] = words[len(words)-1]
+
+	breadcrumbs := []map[string]interface{}{
+		{"Name": c.Name, "Link": c.docsFileName("", format)},
+	}
+	for i := 1; i < len(words); i++ {
+		breadcrumbs = append(breadcrumbs, map[string]interface{}{
+			"Name": words[i-1],
+			"Link": c.docsFileName(strings.Join(words[:i], " "), format),
+		})
+	}
+	data["Breadcrumbs"] = breadcrumbs
+
+	if subcommands, ok := data["Subcommands"].([]map[string]interface{}); ok {
+		for _, sub := range subcommands {
+			sub["Link"] = c.docsFileName(fmt.Sprintf("%s %s", name, sub["Name"]), format)
+		}
+	}
+
+	return data
+}
+
+// writeDocsPage renders the page with the given templates and data to w.
+func (c *CLI) writeDocsPage(w io.Writer, format DocsFormat, tpls map[DocsFormat]string, data map[string]interface{}) error {
+	tpl := strings.TrimSpace(tpls[format]) + "\n"
+	if format == DocsHTML {
+		t, err := htmltemplate.New("root").Funcs(sprig.HtmlFuncMap()).Parse(tpl)
+		if err != nil {
+			return err
+		}
+
+		return t.Execute(w, data)
+	}
+
+	t, err := template.New("root").Funcs(sprig.TxtFuncMap()).Parse(tpl)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(w, data)
+}
+
+// docsFileName returns the name of the file of the page for the command
+// with the given full name, such as "app-foo-bar.md" for "foo bar". The
+// empty name is the index page.
+func (c *CLI) docsFileName(name string, format DocsFormat) string {
+	if name == "" {
+		return "index" + format.extension()
+	}
+
+	return c.Name + "-" + strings.Replace(name, " ", "-", -1) + format.extension()
+}
+
+// docsIndexTemplate are the templates of the index page per format.
+var docsIndexTemplate = map[DocsFormat]string{
+	DocsMarkdown: "# {{ .Name }}" + `
+{{- if .Version }}
+
+Version {{ .Version }}
+{{- end }}
+{{- if .GlobalOptions }}
+
+## Global options
+
+` + "```text" + `
+{{ .GlobalOptions }}
+` + "```" + `
+{{- end }}
+{{- if .Commands }}
+
+## Commands
+{{ range .Commands }}
+* [{{ .Name }}]({{ .Link }}){{ if .Synopsis }} - {{ .Synopsis }}{{ end }}{{ if .Deprecated }} (deprecated){{ end }}
+{{- end }}
+{{- end }}
+`,
+
+	DocsHTML: `
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Name }}</title>
+</head>
+<body>
+<h1>{{ .Name }}</h1>
+{{- if .Version }}
+<p>Version {{ .Version }}</p>
+{{- end }}
+{{- if .GlobalOptions }}
+<h2>Global options</h2>
+<pre>{{ .GlobalOptions }}</pre>
+{{- end }}
+{{- if .Commands }}
+<h2>Commands</h2>
+<ul>
+{{- range .Commands }}
+<li><a href="{{ .Link }}">{{ .Name }}</a>{{ if .Synopsis }} - {{ .Synopsis }}{{ end }}{{ if .Deprecated }} (deprecated){{ end }}</li>
+{{- end }}
+</ul>
+{{- end }}
+</body>
+</html>
+`,
+}
+
+// docsCommandTemplate are the templates of the command pages per format.
+var docsCommandTemplate = map[DocsFormat]string{
+	DocsMarkdown: `
+{{ range .Breadcrumbs }}[{{ .Name }}]({{ .Link }}) › {{ end }}{{ .Command }}
+
+# {{ .Title }}
+{{- if .Synopsis }}
+
+{{ .Synopsis }}
+{{- end }}
+{{- if .Deprecation }}
+
+> {{ .Deprecation }}
+{{- end }}
+{{- if .Help }}
+
+` + "```text" + `
+{{ .Help }}
+` + "```" + `
+{{- end }}
+{{- if .Options }}
+
+## Options
+
+` + "```text" + `
+{{ .Options }}
+` + "```" + `
+{{- end }}
+{{- if .Subcommands }}
+
+## Subcommands
+{{ range .Subcommands }}
+* [{{ .Name }}]({{ .Link }}){{ if .Synopsis }} - {{ .Synopsis }}{{ end }}
+{{- end }}
+{{- end }}
+`,
+
+	DocsHTML: `
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<nav>{{ range .Breadcrumbs }}<a href="{{ .Link }}">{{ .Name }}</a> › {{ end }}{{ .Command }}</nav>
+<h1>{{ .Title }}</h1>
+{{- if .Synopsis }}
+<p>{{ .Synopsis }}</p>
+{{- end }}
+{{- if .Deprecation }}
+<blockquote>{{ .Deprecation }}</blockquote>
+{{- end }}
+{{- if .Help }}
+<pre>{{ .Help }}</pre>
+{{- end }}
+{{- if .Options }}
+<h2>Options</h2>
+<pre>{{ .Options }}</pre>
+{{- end }}
+{{- if .Subcommands }}
+<h2>Subcommands</h2>
+<ul>
+{{- range .Subcommands }}
+<li><a href="{{ .Link }}">{{ .Name }}</a>{{ if .Synopsis }} - {{ .Synopsis }}{{ end }}</li>
+{{- end }}
+</ul>
+{{- end }}
+</body>
+</html>
+`,
+}
@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func testDocsCLI() *CLI {
+	fs := flag.NewFlagSet("bar", flag.ContinueOnError)
+	fs.Bool("force", false, "Don't ask for confirmation.")
+
+	// The deprecated "foo bar baz" isn't listed as a subcommand of
+	// "foo bar", just like in the help output, but still has a page.
+	return &CLI{
+		Name:    "app",
+		Version: "1.0.0",
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{HelpText: "Usage: app foo", SynopsisText: "Does foo."}, nil
+			},
+			"foo bar": func() (Command, error) {
+				return &MockCommandFlags{
+					MockCommand: MockCommand{
+						HelpText:     "\nUsage: app foo bar <a&b>\n",
+						SynopsisText: "Does bar.",
+					},
+					FlagsValue: fs,
+				}, nil
+			},
+			"foo bar baz": func() (Command, error) {
+				return &MockCommand{HelpText: "Usage: app foo bar baz", SynopsisText: "Does baz."}, nil
+			},
+			"foo bar qux": func() (Command, error) {
+				return &MockCommand{HelpText: "Usage: app foo bar qux", SynopsisText: "Does qux."}, nil
+			},
+			"secret": func() (Command, error) {
+				return &MockCommand{HelpText: "secret", SynopsisText: "secret"}, nil
+			},
+			"secret sauce": func() (Command, error) {
+				return &MockCommand{HelpText: "sauce", SynopsisText: "sauce"}, nil
+			},
+		},
+		HiddenCommands: []string{"secret"},
+		DeprecatedCommands: map[string]Deprecation{
+			"foo bar baz": {Replacement: "foo bar qux"},
+		},
+	}
+}
+
+func TestCLIDocs_markdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := testDocsCLI().Docs(dir, DocsMarkdown); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual []string
+	for _, info := range infos {
+		actual = append(actual, info.Name())
+	}
+	sort.Strings(actual)
+
+	expected := []string{"app-foo-bar-baz.md", "app-foo-bar-qux.md", "app-foo-bar.md", "app-foo.md", "index.md"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	cases := map[string]string{
+		"index.md": `# app
+
+Version 1.0.0
+
+## Commands
+
+* [foo](app-foo.md) - Does foo.
+* [foo bar](app-foo-bar.md) - Does bar.
+* [foo bar baz](app-foo-bar-baz.md) - Does baz. (deprecated)
+* [foo bar qux](app-foo-bar-qux.md) - Does qux.
+`,
+
+		"app-foo-bar.md": "[app](index.md) › [foo](app-foo.md) › bar" + `
+
+# app foo bar
+
+Does bar.
+
+` + "```text" + `
+Usage: app foo bar <a&b>
+` + "```" + `
+
+## Options
+
+` + "```text" + `
+    -force    Don't ask for confirmation.
+` + "```" + `
+
+## Subcommands
+
+* [qux](app-foo-bar-qux.md) - Does qux.
+`,
+
+		"app-foo-bar-baz.md": "[app](index.md) › [foo](app-foo.md) › [bar](app-foo-bar.md) › baz" + `
+
+# app foo bar baz
+
+Does baz.
+
+> Warning: The "foo bar baz" command is deprecated. Use "foo bar qux" instead.
+
+` + "```text" + `
+Usage: app foo bar baz
+` + "```" + `
+`,
+	}
+
+	for name, expected := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if string(actual) != expected {
+				t.Fatalf("bad:\n\n%s\n\nexpected:\n\n%s", actual, expected)
+			}
+		})
+	}
+}
+
+func TestCLIDocs_defaultCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		Name: "app",
+		Commands: map[string]CommandFactory{
+			"": func() (Command, error) {
+				return &MockCommand{HelpText: "default", SynopsisText: "Does default."}, nil
+			},
+			"foo": func() (Command, error) {
+				return &MockCommand{HelpText: "foo", SynopsisText: "Does foo."}, nil
+			},
+		},
+	}
+
+	if err := cli.Docs(dir, DocsMarkdown); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual []string
+	for _, info := range infos {
+		actual = append(actual, info.Name())
+	}
+	sort.Strings(actual)
+
+	expected := []string{"app-foo.md", "index.md"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The default command must not replace the index or be listed in it
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "index.md"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expectedIndex := `# app
+
+## Commands
+
+* [foo](app-foo.md) - Does foo.
+`
+	if string(contents) != expectedIndex {
+		t.Fatalf("bad:\n\n%s", contents)
+	}
+}
+
+func TestCLIDocs_html(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := testDocsCLI().Docs(dir, DocsHTML); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual []string
+	for _, info := range infos {
+		actual = append(actual, info.Name())
+	}
+	sort.Strings(actual)
+
+	expected := []string{"app-foo-bar-baz.html", "app-foo-bar-qux.html", "app-foo-bar.html", "app-foo.html", "index.html"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "app-foo-bar.html"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, s := range []string{
+		`<nav><a href="index.html">app</a> › <a href="app-foo.html">foo</a> › bar</nav>`,
+		`<pre>Usage: app foo bar &lt;a&amp;b&gt;</pre>`,
+		`<li><a href="app-foo-bar-qux.html">qux</a> - Does qux.</li>`,
+	} {
+		if !strings.Contains(string(contents), s) {
+			t.Fatalf("missing %q:\n\n%s", s, contents)
+		}
+	}
+}
+
+func TestCLIDocs_noName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := testDocsCLI()
+	cli.Name = ""
+	if err := cli.Docs(dir, DocsMarkdown); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"flag"
+)
+
+// CommandEnv is what the CLI gives to a CommandEnvFactory, so that a
+// command can be created from the shared state of a run rather than from
+// globals captured by a closure.
+type CommandEnv struct {
+	// Ui is the Ui of the CLI.
+	Ui Ui
+
+	// GlobalFlags is the GlobalFlags of the CLI. When the command is
+	// created to run it, it is the flag set that the global flags of the
+	// run were parsed into, see GlobalFlagsFunc.
+	GlobalFlags *flag.FlagSet
+
+	// Name and Version are the Name and Version of the CLI.
+	Name    string
+	Version string
+
+	// Subcommand is the full name of the command that is created, such as
+	// "state show".
+	Subcommand string
+
+	// Context is the Context of the CLI, or context.Background() if it
+	// isn't set. When the command is created to run it, the Context is
+	// the one that is cancelled on an interrupt, as for a CommandContext.
+	Context context.Context
+
+	// Deps is the Deps of the CLI.
+	Deps interface{}
+}
+
+// CommandEnvFactory is a factory of a command that receives the
+// CommandEnv. See CLI.EnvCommands.
+type CommandEnvFactory func(env *CommandEnv) (Command, error)
+
+// envCommandFactory returns the CommandFactory for the command with the
+// given full key that calls f with the environment of the CLI.
+func (c *CLI) envCommandFactory(k string, f CommandEnvFactory) CommandFactory {
+	return func() (Command, error) {
+		ctx := c.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		return f(c.commandEnv(k, ctx, c.GlobalFlags))
+	}
+}
+
+// runFactory returns the factory for running the command with the given
+// full key, which gives the context of the run to an env command.
+func (inv *Invocation) runFactory(k string, f CommandFactory) CommandFactory {
+	if ef, ok := inv.cli.envCommands[k]; ok {
+		return func() (Command, error) {
+			return ef(inv.cli.commandEnv(k, inv.runContext(), inv.globalFlags))
+		}
+	}
+
+	return f
+}
+
+// commandEnv returns the environment for creating the command with the
+// given full key.
+func (c *CLI) commandEnv(k string, ctx context.Context, fs *flag.FlagSet) *CommandEnv {
+	return &CommandEnv{
+		Ui:          c.Ui,
+		GlobalFlags: fs,
+		Name:        c.Name,
+		Version:     c.Version,
+		Subcommand:  k,
+		Context:     ctx,
+		Deps:        c.Deps,
+	}
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCLIRun_envCommands(t *testing.T) {
+	type deps struct {
+		Endpoint string
+	}
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.String("region", "", "")
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	var env *CommandEnv
+	command := new(MockCommand)
+	ui := NewMockUi()
+	cli := &CLI{
+		Name:    "app",
+		Version: "1.0.0",
+		Args:    []string{"-region=eu", "state", "show", "-x"},
+		EnvCommands: map[string]CommandEnvFactory{
+			"state show": func(e *CommandEnv) (Command, error) {
+				env = e
+				return command, nil
+			},
+		},
+		GlobalFlags: fs,
+		Context:     ctx,
+		Ui:          ui,
+		Deps:        &deps{Endpoint: "http://localhost"},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !command.RunCalled || !reflect.DeepEqual(command.RunArgs, []string{"-x"}) {
+		t.Fatalf("bad: %#v", command.RunArgs)
+	}
+
+	if env.Ui != ui || env.Name != "app" || env.Version != "1.0.0" || env.Subcommand != "state show" {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	// The global flags are parsed by the time the command is created
+	if v := env.GlobalFlags.Lookup("region").Value.String(); v != "eu" {
+		t.Fatalf("bad: %q", v)
+	}
+
+	if env.Context.Value(ctxKey{}) != "value" {
+		t.Fatalf("bad: %#v", env.Context)
+	}
+
+	if d, ok := env.Deps.(*deps); !ok || d.Endpoint != "http://localhost" {
+		t.Fatalf("bad: %#v", env.Deps)
+	}
+}
+
+func TestCLIRun_envCommandsDefaults(t *testing.T) {
+	var env *CommandEnv
+	cli := &CLI{
+		Args: []string{"foo"},
+		EnvCommands: map[string]CommandEnvFactory{
+			"foo": func(e *CommandEnv) (Command, error) {
+				env = e
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, ok := env.Ui.(*BasicUi); !ok {
+		t.Fatalf("bad: %#v", env.Ui)
+	}
+
+	if env.Context == nil {
+		t.Fatal("context should be set")
+	}
+}
+
+func TestCLIRun_envCommandsHelp(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "plain foo"}, nil
+			},
+		},
+		EnvCommands: map[string]CommandEnvFactory{
+			"foo": func(e *CommandEnv) (Command, error) {
+				return &MockCommand{SynopsisText: "env foo"}, nil
+			},
+			"bar": func(e *CommandEnv) (Command, error) {
+				return &MockCommand{SynopsisText: "env " + e.Subcommand}, nil
+			},
+		},
+		HelpWriter: buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Commands take precedence over env commands
+	for _, s := range []string{"bar    env bar", "foo    plain foo"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("missing %q:\n\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestCLIRun_envCommandsShareUi(t *testing.T) {
+	var uis []Ui
+	factory := func(e *CommandEnv) (Command, error) {
+		uis = append(uis, e.Ui)
+		return new(MockCommand), nil
+	}
+
+	cli := &CLI{
+		Args: []string{"-h"},
+		EnvCommands: map[string]CommandEnvFactory{
+			"foo": factory,
+			"bar": factory,
+		},
+		HelpWriter: new(bytes.Buffer),
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := cli.Invoke([]string{"foo"}).Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(uis) != 3 {
+		t.Fatalf("bad: %#v", uis)
+	}
+
+	// The default Ui is only created once
+	if _, ok := uis[0].(*BasicUi); !ok || uis[1] != uis[0] || uis[2] != uis[0] {
+		t.Fatalf("bad: %#v", uis)
+	}
+}
+
+func TestCLIRun_envCommandsInterrupt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending interrupts is not supported on Windows")
+	}
+
+	var env *CommandEnv
+	cli := &CLI{
+		Args: []string{"foo"},
+		EnvCommands: map[string]CommandEnvFactory{
+			"foo": func(e *CommandEnv) (Command, error) {
+				env = e
+				return &testFuncCommand{
+					RunFunc: func(args []string) int {
+						testSignal(t)
+						select {
+						case <-e.Context.Done():
+							return 42
+						case <-time.After(5 * time.Second):
+							t.Error("context was not cancelled")
+							return 1
+						}
+					},
+				}, nil
+			},
+		},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	// The context is the one of the run
+	if env.Context.Err() == nil {
+		t.Fatal("context should be cancelled once the command returns")
+	}
+}
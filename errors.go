@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ExitError is an error that carries the exit status for the CLI. It can
+// be returned from CommandE.RunE, possibly wrapped, to control how the
+// error is reported.
+type ExitError struct {
+	// Code is the exit status. If it is zero, the exit status is 1.
+	Code int
+
+	// Err is the underlying error. If it is nil, no error message is
+	// printed and only the exit status is used.
+	Err error
+
+	// ShowUsage shows the help of the command after the error, as if
+	// the command had returned RunResultHelp.
+	ShowUsage bool
+}
+
+// NewExitError returns an ExitError with the given exit status.
+func NewExitError(code int, err error) *ExitError {
+	return &ExitError{Code: code, Err: err}
+}
+
+// NewUsageError returns an ExitError with exit status 1 that shows the help
+// of the command after the error.
+func NewUsageError(err error) *ExitError {
+	return &ExitError{Code: 1, Err: err, ShowUsage: true}
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.code())
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// code returns the exit status to use for the error.
+func (e *ExitError) code() int {
+	if e.Code == 0 {
+		return 1
+	}
+
+	return e.Code
+}
+
+// handleError reports an error returned by the command and returns the
+// exit status for it.
+func (inv *Invocation) handleError(command Command, err error) int {
+	c := inv.cli
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+		return 1
+	}
+
+	// Only print the message if there is one. We print the whole error
+	// rather than exitErr in case it was wrapped with more context.
+	if exitErr.Err != nil {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+	}
+
+	if exitErr.ShowUsage {
+		if exitErr.Err != nil {
+			c.ErrorWriter.Write([]byte("\n"))
+		}
+
+		inv.commandHelp(c.ErrorWriter, command)
+	}
+
+	return exitErr.code()
+}
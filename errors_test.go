@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCLIRun_commandE(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		exitCode int
+		output   string
+	}{
+		{"nil", nil, 0, ""},
+		{"error", errors.New("boom"), 1, "Error: boom\n"},
+		{"exit error", NewExitError(3, errors.New("boom")), 3, "Error: boom\n"},
+		{"exit error no message", &ExitError{Code: 4}, 4, ""},
+		{"exit error no code", &ExitError{Err: errors.New("boom")}, 1, "Error: boom\n"},
+		{"usage error", NewUsageError(errors.New("boom")), 1, "Error: boom\n\ndonuts\n"},
+		{
+			"wrapped",
+			fmt.Errorf("context: %w", NewExitError(5, errors.New("boom"))),
+			5,
+			"Error: context: boom\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			command := &MockCommandE{
+				MockCommand: MockCommand{HelpText: "donuts", RunResult: 42},
+				RunEResult:  tc.err,
+			}
+			cli := &CLI{
+				Args: []string{"foo", "bar"},
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						return command, nil
+					},
+				},
+				ErrorWriter: buf,
+			}
+
+			exitCode, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != tc.exitCode {
+				t.Fatalf("bad exit code: %d", exitCode)
+			}
+
+			if command.RunCalled || !command.RunECalled {
+				t.Fatalf("RunE should be called instead of Run")
+			}
+
+			if buf.String() != tc.output {
+				t.Fatalf("bad output: %q", buf.String())
+			}
+		})
+	}
+}
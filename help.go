@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"log"
 	"sort"
@@ -22,42 +23,161 @@ func BasicHelpFunc(app string) HelpFunc {
 			app))
 		buf.WriteString("Available commands are:\n")
 
-		// Get the list of keys so we can sort them, and also get the maximum
-		// key length so they can be aligned properly.
-		keys := make([]string, 0, len(commands))
-		maxKeyLen := 0
-		for key := range commands {
-			if len(key) > maxKeyLen {
-				maxKeyLen = len(key)
-			}
+		entries, maxKeyLen := helpEntries(commands)
+		writeHelpEntries(&buf, entries, maxKeyLen)
+		return buf.String()
+	}
+}
+
+// CategorizedHelpFunc generates help output like BasicHelpFunc, but groups
+// the commands into a section per category. The category of a command
+// comes from CLI.Categories or from its CommandCategory implementation.
+//
+// The sections are listed in the given order, which is typically the
+// CategoryOrder of the CLI, followed by any other categories in
+// alphabetical order and finally the commands without a category as
+// "Other commands". The category is used as the heading of its section, so
+// categories are typically named like "Common commands".
+func CategorizedHelpFunc(app string, order []string) HelpFunc {
+	return func(commands map[string]CommandFactory) string {
+		var buf bytes.Buffer
+		buf.WriteString(fmt.Sprintf(
+			"Usage: %s [--version] [--help] <command> [<args>]\n\n",
+			app))
 
-			keys = append(keys, key)
+		entries, maxKeyLen := helpEntries(commands)
+		groups := make(map[string][]helpEntry)
+		for _, e := range entries {
+			groups[e.Category] = append(groups[e.Category], e)
 		}
-		sort.Strings(keys)
-
-		for _, key := range keys {
-			commandFunc, ok := commands[key]
-			if !ok {
-				// This should never happen since we JUST built the list of
-				// keys.
-				panic("command not found: " + key)
+
+		categories := orderCategories(groups, order)
+		for i, category := range categories {
+			if i > 0 {
+				buf.WriteString("\n")
 			}
 
-			command, err := commandFunc()
-			if err != nil {
-				log.Printf("[ERR] cli: Command '%s' failed to load: %s",
-					key, err)
-				continue
+			switch {
+			case category != "":
+				buf.WriteString(category + ":\n")
+			case len(categories) == 1:
+				buf.WriteString("Available commands are:\n")
+			default:
+				buf.WriteString("Other commands:\n")
 			}
 
-			key = fmt.Sprintf("%s%s", key, strings.Repeat(" ", maxKeyLen-len(key)))
-			buf.WriteString(fmt.Sprintf("    %s    %s\n", key, command.Synopsis()))
+			writeHelpEntries(&buf, groups[category], maxKeyLen)
 		}
 
 		return buf.String()
 	}
 }
 
+// helpEntry is a single command in the help output.
+type helpEntry struct {
+	Name     string
+	Synopsis string
+	Category string
+}
+
+// helpEntries instantiates the given commands and returns their help
+// entries sorted by name, along with the length of the longest name.
+// The name includes any aliases of the command.
+func helpEntries(commands map[string]CommandFactory) ([]helpEntry, int) {
+	keys := make([]string, 0, len(commands))
+	for key := range commands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]helpEntry, 0, len(keys))
+	maxKeyLen := 0
+	for _, key := range keys {
+		commandFunc, ok := commands[key]
+		if !ok {
+			// This should never happen since we JUST built the list of
+			// keys.
+			panic("command not found: " + key)
+		}
+
+		command, err := commandFunc()
+		if err != nil {
+			log.Printf("[ERR] cli: Command '%s' failed to load: %s",
+				key, err)
+			continue
+		}
+
+		name := key
+		if a, ok := command.(CommandAliases); ok && len(a.Aliases()) > 0 {
+			name = fmt.Sprintf("%s (%s)", key, strings.Join(a.Aliases(), ", "))
+		}
+		if len(name) > maxKeyLen {
+			maxKeyLen = len(name)
+		}
+
+		entries = append(entries, helpEntry{
+			Name:     name,
+			Synopsis: command.Synopsis(),
+			Category: commandCategory(command),
+		})
+	}
+
+	return entries, maxKeyLen
+}
+
+// writeHelpEntries writes a line for each entry with the names padded to
+// the given length.
+func writeHelpEntries(buf *bytes.Buffer, entries []helpEntry, maxKeyLen int) {
+	for _, e := range entries {
+		name := fmt.Sprintf("%s%s", e.Name, strings.Repeat(" ", maxKeyLen-len(e.Name)))
+		buf.WriteString(fmt.Sprintf("    %s    %s\n", name, e.Synopsis))
+	}
+}
+
+// commandCategory returns the category of the command, or "" if it
+// doesn't have one.
+func commandCategory(command Command) string {
+	if c, ok := command.(CommandCategory); ok {
+		return c.Category()
+	}
+
+	return ""
+}
+
+// orderCategories returns the keys of groups in the given order, followed
+// by the remaining ones in alphabetical order. The empty category for
+// commands without one always comes last.
+func orderCategories(groups map[string][]helpEntry, order []string) []string {
+	result := make([]string, 0, len(groups))
+	seen := make(map[string]struct{}, len(groups))
+	for _, category := range order {
+		if _, ok := groups[category]; !ok || category == "" {
+			continue
+		}
+		if _, ok := seen[category]; ok {
+			continue
+		}
+
+		seen[category] = struct{}{}
+		result = append(result, category)
+	}
+
+	var rest []string
+	for category := range groups {
+		if _, ok := seen[category]; !ok && category != "" {
+			rest = append(rest, category)
+		}
+	}
+	sort.Strings(rest)
+	result = append(result, rest...)
+
+	if _, ok := groups[""]; ok {
+		result = append(result, "")
+	}
+
+	return result
+}
+
 // FilteredHelpFunc will filter the commands to only include the keys
 // in the include parameter.
 func FilteredHelpFunc(include []string, f HelpFunc) HelpFunc {
@@ -77,3 +197,102 @@ func FilteredHelpFunc(include []string, f HelpFunc) HelpFunc {
 		return f(filtered)
 	}
 }
+
+// flagsHelp returns the help for all of the flags in the given flag set,
+// one per line, aligned in the same way as the list of commands.
+func flagsHelp(fs *flag.FlagSet) string {
+	var names, usages []string
+	maxLen := 0
+	fs.VisitAll(func(f *flag.Flag) {
+		valueName, usage := flag.UnquoteUsage(f)
+		name := "-" + f.Name
+		if valueName != "" {
+			name += "=" + valueName
+		}
+		if len(name) > maxLen {
+			maxLen = len(name)
+		}
+
+		if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false" {
+			usage = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", usage, f.DefValue))
+		}
+
+		names = append(names, name)
+		usages = append(usages, usage)
+	})
+
+	var buf bytes.Buffer
+	for i, name := range names {
+		name = fmt.Sprintf("%s%s", name, strings.Repeat(" ", maxLen-len(name)))
+		buf.WriteString(strings.TrimRight(fmt.Sprintf("    %s    %s", name, usages[i]), " ") + "\n")
+	}
+
+	return buf.String()
+}
+
+// isBoolFlag returns true if the flag doesn't need a value, such as
+// flags created with flag.Bool.
+func isBoolFlag(f *flag.Flag) bool {
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
+// CommandAliases is implemented by the commands given to a HelpFunc when
+// they have aliases registered with CLI.Aliases. HelpFunc implementations
+// can use it to list the aliases next to the command.
+type CommandAliases interface {
+	// Aliases returns the names of the aliases for this command.
+	Aliases() []string
+}
+
+// helpCommandFactory wraps a CommandFactory so that the commands it
+// creates also carry the given aliases, category and deprecation for a
+// HelpFunc.
+func helpCommandFactory(f CommandFactory, aliases []string, category string, d *Deprecation) CommandFactory {
+	return func() (Command, error) {
+		command, err := f()
+		if err != nil {
+			return nil, err
+		}
+
+		return &helpCommand{
+			Command:     command,
+			aliases:     aliases,
+			category:    category,
+			deprecation: d,
+		}, nil
+	}
+}
+
+// helpCommand is a Command with the information from the CLI that a
+// HelpFunc can't get from the command itself.
+type helpCommand struct {
+	Command
+
+	aliases     []string
+	category    string
+	deprecation *Deprecation
+}
+
+// Synopsis marks the synopsis of a deprecated command, so that the help
+// output with "-all" points to where the command went.
+func (c *helpCommand) Synopsis() string {
+	synopsis := c.Command.Synopsis()
+	if c.deprecation != nil {
+		synopsis = strings.TrimSpace(synopsis + " " + c.deprecation.helpNote())
+	}
+
+	return synopsis
+}
+
+func (c *helpCommand) Aliases() []string {
+	return c.aliases
+}
+
+func (c *helpCommand) Category() string {
+	if c.category != "" {
+		return c.category
+	}
+
+	return commandCategory(c.Command)
+}
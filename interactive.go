@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// RunInteractive runs the CLI as an interactive shell. It shows a prompt,
+// reads a line, splits it into arguments with the same quoting rules as
+// response files and runs it like the arguments of Run, until the input
+// ends or the user exits. This saves the start up cost of the application,
+// such as authentication, for each of a series of commands.
+//
+// The lines are read with ui. If ui is a BasicUi that reads from a
+// terminal, the line can be edited, earlier lines are recalled with the
+// arrow keys and the tab key completes commands and flags like the
+// "__complete" command does. Otherwise, the lines are read with Ask. In
+// both cases an interrupt such as Ctrl-C discards the line.
+//
+// An interrupt while a command runs only ends that command, never the
+// shell. It cancels the context of a command that has one, see Context,
+// and the shell waits for the command to return however many interrupts
+// follow. Commands without a context can't be stopped, so the interrupt
+// is ignored for them.
+//
+// There are two built-in commands. "help" shows the help, or the help of
+// a command such as "help foo bar", and "exit" exits with the status of
+// the last command, or with the status it is given such as "exit 1".
+//
+// Every line is run as a new Invocation, so with GlobalFlagsFunc the
+// global flags only have the values given on the line. RunInteractive
+// returns the exit status of the last command.
+func (c *CLI) RunInteractive(ui Ui) (int, error) {
+	c.once.Do(c.init)
+
+	prompt := c.Prompt
+	if prompt == "" {
+		name := c.Name
+		if name == "" {
+			name = "app"
+		}
+
+		prompt = name + "> "
+	}
+
+	lines := c.lineReader(ui, prompt)
+
+	// Handle interrupts for as long as the shell runs, so that they don't
+	// end it. They still reach a BasicUi that is asking and the commands
+	// that handle them, see runCommand.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	intCh, stop := filterPromptInterrupts(sigCh, doneCh)
+	defer stop()
+	go func() {
+		for {
+			select {
+			case <-intCh:
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+
+	exitCode := 0
+	for {
+		line, err := lines.ReadLine()
+		if err == io.EOF {
+			return exitCode, nil
+		}
+		if err != nil {
+			if err == errInterrupted {
+				// Like in a shell, an interrupt only discards the line
+				continue
+			}
+
+			return exitCode, err
+		}
+
+		args, err := splitArgs(line, true)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error: %s", err))
+			exitCode = 1
+			continue
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit":
+			if len(args) > 1 {
+				code, err := strconv.Atoi(args[1])
+				if err != nil {
+					ui.Error(fmt.Sprintf("Error: invalid exit status %q", args[1]))
+					continue
+				}
+
+				exitCode = code
+			}
+
+			return exitCode, nil
+
+		case "help":
+			args = append(args[1:], "-help")
+		}
+
+		inv := c.Invoke(args)
+		inv.interactive = true
+		exitCode, err = inv.Run()
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error: %s", err))
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+	}
+}
+
+// lineReader reads the lines of an interactive shell.
+type lineReader interface {
+	// ReadLine returns the next line without the line ending, or io.EOF
+	// if there are no more lines.
+	ReadLine() (string, error)
+}
+
+// lineReader returns the reader of lines for RunInteractive.
+func (c *CLI) lineReader(ui Ui, prompt string) lineReader {
+	if bu, ok := ui.(*BasicUi); ok {
+		in, inOk := bu.Reader.(*os.File)
+		out, outOk := bu.Writer.(*os.File)
+		if inOk && outOk && term.IsTerminal(int(in.Fd())) && term.IsTerminal(int(out.Fd())) {
+			return c.newTerminalLineReader(in, out, prompt)
+		}
+	}
+
+	return &uiLineReader{ui: ui, prompt: strings.TrimRight(prompt, " ")}
+}
+
+// uiLineReader reads lines by asking the Ui for them.
+type uiLineReader struct {
+	ui     Ui
+	prompt string
+}
+
+func (r *uiLineReader) ReadLine() (string, error) {
+	return r.ui.Ask(r.prompt)
+}
+
+// terminalLineReader reads lines from a terminal with line editing,
+// history and tab completion.
+type terminalLineReader struct {
+	fd   int
+	in   *interruptReader
+	term *term.Terminal
+}
+
+func (c *CLI) newTerminalLineReader(in, out *os.File, prompt string) *terminalLineReader {
+	r := &terminalLineReader{fd: int(in.Fd()), in: &interruptReader{r: in}}
+	r.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{r.in, out}, prompt)
+	r.term.AutoCompleteCallback = c.completeLine
+
+	return r
+}
+
+func (r *terminalLineReader) ReadLine() (string, error) {
+	// The terminal is only in raw mode while reading the line, so that
+	// the output of the commands is shown as usual.
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+
+	if width, height, err := term.GetSize(r.fd); err == nil {
+		r.term.SetSize(width, height)
+	}
+
+	return r.readLine()
+}
+
+// readLine reads a line from the terminal, which must be in raw mode.
+func (r *terminalLineReader) readLine() (string, error) {
+	line, err := r.term.ReadLine()
+	switch {
+	case err == term.ErrPasteIndicator:
+		err = nil
+	case err == nil && line == "" && r.in.interrupted:
+		err = errInterrupted
+	}
+
+	return line, err
+}
+
+const (
+	keyCtrlC = 3
+	keyCtrlE = 5
+	keyCtrlU = 21
+	keyEnter = '\r'
+)
+
+// interruptReader reads the input of a terminal in raw mode and replaces
+// Ctrl-C with the keys that clear the line and end it. The terminal would
+// return io.EOF for Ctrl-C, like for Ctrl-D, and then see the same Ctrl-C
+// again when reading the next line. The reader records whether the last
+// read had a Ctrl-C, so that the empty line can be told apart.
+type interruptReader struct {
+	r           io.Reader
+	interrupted bool
+	pending     []byte
+}
+
+func (r *interruptReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		buf := make([]byte, len(p))
+		n, err := r.r.Read(buf)
+		if n == 0 {
+			return 0, err
+		}
+
+		buf = buf[:n]
+		r.interrupted = bytes.IndexByte(buf, keyCtrlC) >= 0
+		r.pending = bytes.ReplaceAll(buf, []byte{keyCtrlC}, []byte{keyCtrlE, keyCtrlU, keyEnter})
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// completeLine is the tab completion of an interactive shell. It completes
+// the word before the cursor with the candidates of the "__complete"
+// command, up to where they differ. See term.Terminal for the
+// arguments and results.
+func (c *CLI) completeLine(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	// Splitting can fail while the user is typing, such as in the middle
+	// of a quote, in which case there is nothing to complete.
+	words, err := splitArgs(line[:pos], false)
+	if err != nil {
+		return "", 0, false
+	}
+
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(line[:pos], " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	// Complete like the hidden complete command
+	inv := c.Invoke(words)
+	inv.completeWord = word
+	completions, _ := inv.completions()
+
+	if len(completions) == 0 {
+		return "", 0, false
+	}
+
+	prefix := completions[0].Value
+	for _, comp := range completions[1:] {
+		prefix = commonPrefix(prefix, comp.Value)
+	}
+
+	if len(completions) == 1 {
+		prefix += " "
+	}
+
+	if !strings.HasPrefix(prefix, word) || prefix == word {
+		return "", 0, false
+	}
+
+	newLine := line[:pos] + prefix[len(word):]
+	return newLine + line[pos:], len(newLine), true
+}
+
+// commonPrefix returns the longest common prefix of a and b.
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:i]
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"golang.org/x/term"
+)
+
+func TestCLIRunInteractive(t *testing.T) {
+	foo := &MockCommand{HelpText: "foo help", RunResult: 2}
+	bar := &MockCommand{HelpText: "bar help"}
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Name: "app",
+		Args: []string{"ignored"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return foo, nil
+			},
+			"foo bar": func() (Command, error) {
+				return bar, nil
+			},
+		},
+		HelpWriter: buf,
+	}
+
+	ui := NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(`
+foo 'a b' c # a comment
+foo bar -x
+help foo bar
+foo "unterminated
+`))
+
+	exitCode, err := cli.RunInteractive(ui)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The last line failed to split
+	if exitCode != 1 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	if !foo.RunCalled || !reflect.DeepEqual(foo.RunArgs, []string{"a b", "c"}) {
+		t.Fatalf("bad: %#v", foo.RunArgs)
+	}
+
+	if !bar.RunCalled || !reflect.DeepEqual(bar.RunArgs, []string{"-x"}) {
+		t.Fatalf("bad: %#v", bar.RunArgs)
+	}
+
+	if !strings.Contains(buf.String(), "bar help") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+
+	if !strings.Contains(ui.OutputWriter.String(), "app>") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+
+	if !strings.Contains(ui.ErrorWriter.String(), "Error: ") {
+		t.Fatalf("bad: %s", ui.ErrorWriter.String())
+	}
+}
+
+func TestCLIRunInteractive_exit(t *testing.T) {
+	cases := []struct {
+		Input string
+		Code  int
+	}{
+		{"foo\nexit\nfoo\n", 2},
+		{"exit 3\nfoo\n", 3},
+		{"exit nope\nexit\n", 0},
+		{"", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Input, func(t *testing.T) {
+			command := &MockCommand{RunResult: 2}
+			cli := &CLI{
+				Commands: map[string]CommandFactory{
+					"foo": func() (Command, error) {
+						command.RunCalled = false
+						return command, nil
+					},
+				},
+				HelpWriter: new(bytes.Buffer),
+			}
+
+			ui := NewMockUi()
+			ui.InputReader = iotest.OneByteReader(strings.NewReader(tc.Input))
+
+			exitCode, err := cli.RunInteractive(ui)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != tc.Code {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			// Nothing runs after exiting
+			if command.RunCalled && strings.HasPrefix(tc.Input, "exit") {
+				t.Fatal("run should not be called")
+			}
+		})
+	}
+}
+
+func TestCLIRunInteractive_interrupt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending interrupts is not supported on Windows")
+	}
+
+	exitCh := make(chan int, 1)
+	plain := &testFuncCommand{RunFunc: func(args []string) int {
+		// Without the shell, the interrupt would kill the process
+		testSignal(t)
+		time.Sleep(50 * time.Millisecond)
+		return 0
+	}}
+	command := &testContextCommand{
+		RunFunc: func(ctx context.Context, args []string) int {
+			testSignal(t)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+				t.Error("context should be cancelled")
+				return 1
+			}
+
+			// A second interrupt doesn't exit the shell either
+			testSignal(t)
+			time.Sleep(50 * time.Millisecond)
+			return 42
+		},
+	}
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"plain": func() (Command, error) {
+				return plain, nil
+			},
+			"foo": func() (Command, error) {
+				return command, nil
+			},
+		},
+		ErrorWriter: new(bytes.Buffer),
+		exitFunc:    func(code int) { exitCh <- code },
+	}
+
+	ui := NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader("plain\nfoo\n"))
+
+	exitCode, err := cli.RunInteractive(ui)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 42 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	select {
+	case <-exitCh:
+		t.Fatal("exit should not be called")
+	default:
+	}
+}
+
+func TestTerminalLineReader_interrupt(t *testing.T) {
+	// Every string is read at once, like the keys typed by the user
+	in := &interruptReader{r: io.MultiReader(
+		strings.NewReader("foo\r"),
+		strings.NewReader("bar\x02\x03"),
+		strings.NewReader("baz\r"),
+		strings.NewReader("\r"),
+		strings.NewReader("\x04"),
+	)}
+	r := &terminalLineReader{in: in}
+	r.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, ioutil.Discard}, "> ")
+
+	cases := []struct {
+		Line string
+		Err  error
+	}{
+		{"foo", nil},
+		{"", errInterrupted},
+		{"baz", nil},
+		{"", nil},
+		{"", io.EOF},
+	}
+
+	for _, tc := range cases {
+		line, err := r.readLine()
+		if line != tc.Line || err != tc.Err {
+			t.Fatalf("bad: %q %v", line, err)
+		}
+	}
+}
+
+func TestCLICompleteLine(t *testing.T) {
+	cases := []struct {
+		Line     string
+		Pos      int
+		Expected string
+		OK       bool
+	}{
+		{"st", 2, "state ", true},
+		{"state l", 7, "state list ", true},
+		{"state ", 6, "state list ", true},
+		{"p", 1, "pl", true},
+		{"pl", 2, "", false},
+		{"nope ", 5, "", false},
+		{"st foo", 2, "state  foo", true},
+		{"'st", 3, "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Line, func(t *testing.T) {
+			cli := &CLI{
+				Commands: map[string]CommandFactory{
+					"plan": func() (Command, error) {
+						return new(MockCommand), nil
+					},
+					"plugins": func() (Command, error) {
+						return new(MockCommand), nil
+					},
+					"state list": func() (Command, error) {
+						return new(MockCommand), nil
+					},
+				},
+			}
+			cli.once.Do(cli.init)
+
+			line, pos, ok := cli.completeLine(tc.Line, tc.Pos, '\t')
+			if ok != tc.OK {
+				t.Fatalf("bad: %v", ok)
+			}
+
+			if line != tc.Expected {
+				t.Fatalf("bad: %q", line)
+			}
+
+			if ok && pos != tc.Pos+len(tc.Expected)-len(tc.Line) {
+				t.Fatalf("bad: %d", pos)
+			}
+
+			// Completing must not leave any args behind
+			if cli.Subcommand() != "" {
+				t.Fatalf("bad: %q", cli.Subcommand())
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CommandInfo describes a command of the CLI and its subcommands, as
+// returned by CLI.CommandTree. It is meant to be encoded as JSON for tools
+// such as IDE plugins and wrappers that need the structure of the CLI.
+type CommandInfo struct {
+	// Path is the full name of the command, such as "foo bar". It is
+	// empty for the CLI itself.
+	Path string `json:"path"`
+
+	// Name is the last word of the path, or the name of the CLI itself.
+	Name string `json:"name"`
+
+	// Synopsis and Help are the synopsis and help text of the command.
+	// For the CLI itself, Help is the output of the HelpFunc.
+	Synopsis string `json:"synopsis"`
+	Help     string `json:"help"`
+
+	// Hidden is true if the command or one of its parents is hidden.
+	Hidden bool `json:"hidden"`
+
+	// Generated is true if the command was created automatically because
+	// it is the missing parent of a nested subcommand.
+	Generated bool `json:"generated"`
+
+	// Flags are the sorted flags that are autocompleted for the command,
+	// such as "-force".
+	Flags []string `json:"flags"`
+
+	// Subcommands are the direct subcommands of the command, sorted by
+	// name.
+	Subcommands []*CommandInfo `json:"subcommands"`
+}
+
+// CommandTree returns the full command tree of the CLI, including hidden
+// and deprecated commands. Every command is instantiated to build it. An
+// error is returned if any of the commands fails to load.
+func (c *CLI) CommandTree() (*CommandInfo, error) {
+	c.once.Do(c.init)
+
+	return c.commandInfo("")
+}
+
+// writeCommandTreeJSON writes the part of the command tree for the command
+// with the given full name to HelpWriter, returning the exit status.
+func (c *CLI) writeCommandTreeJSON(name string) int {
+	info, err := c.commandInfo(name)
+	if err != nil {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+		return 1
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		c.ErrorWriter.Write([]byte(fmt.Sprintf("Error: %s\n", err)))
+		return 1
+	}
+
+	c.HelpWriter.Write(append(data, '\n'))
+	return 0
+}
+
+// commandInfo returns the part of the command tree for the command with
+// the given full name. The empty name is the CLI itself.
+func (c *CLI) commandInfo(name string) (*CommandInfo, error) {
+	info := &CommandInfo{
+		Path:        name,
+		Name:        c.Name,
+		Flags:       []string{},
+		Subcommands: []*CommandInfo{},
+	}
+
+	if name == "" {
+		info.Help = c.helpText("", false)
+		info.Flags = c.rootFlagNames()
+	} else {
+		raw, ok := c.commandTree.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("command not found: %s", name)
+		}
+
+		command, err := raw.(CommandFactory)()
+		if err != nil {
+			return nil, fmt.Errorf("command %q failed to load: %s", name, err)
+		}
+
+		info.Name = name[strings.LastIndex(name, " ")+1:]
+		info.Synopsis = command.Synopsis()
+		info.Help = command.Help()
+		info.Hidden = c.hiddenPath(name)
+		_, info.Generated = c.commandGenerated[name]
+		for k := range autocompleteFlags(command) {
+			info.Flags = append(info.Flags, k)
+		}
+		sort.Strings(info.Flags)
+	}
+
+	for _, k := range c.childCommands(name) {
+		sub, err := c.commandInfo(k)
+		if err != nil {
+			return nil, err
+		}
+
+		info.Subcommands = append(info.Subcommands, sub)
+	}
+
+	return info, nil
+}
+
+// childCommands returns the sorted full names of all the direct
+// subcommands of the given command, including hidden and deprecated ones.
+func (c *CLI) childCommands(parent string) []string {
+	prefix := parent
+	if prefix != "" {
+		prefix += " "
+	}
+
+	var result []string
+	c.commandTree.WalkPrefix(prefix, func(k string, raw interface{}) bool {
+		// The default command isn't a subcommand of anything
+		if k != "" && !strings.Contains(k[len(prefix):], " ") {
+			result = append(result, k)
+		}
+
+		return false
+	})
+
+	sort.Strings(result)
+	return result
+}
+
+// rootFlagNames returns the sorted flags of the CLI itself.
+func (c *CLI) rootFlagNames() []string {
+	flags := map[string]struct{}{
+		"-help":    {},
+		"-version": {},
+	}
+
+	if c.HelpJSON {
+		flags["-help-json"] = struct{}{}
+	}
+
+	if c.Autocomplete {
+		flags["-"+c.AutocompleteInstall] = struct{}{}
+		flags["-"+c.AutocompleteUninstall] = struct{}{}
+		flags["-"+c.AutocompleteScript] = struct{}{}
+	}
+
+	if c.GlobalFlags != nil {
+		for k := range flagsPredictors(c.GlobalFlags) {
+			flags[k] = struct{}{}
+		}
+	}
+
+	for k := range c.AutocompleteGlobalFlags {
+		flags[k] = struct{}{}
+	}
+
+	result := make([]string, 0, len(flags))
+	for k := range flags {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func testIntrospectCLI() *CLI {
+	fs := flag.NewFlagSet("bar", flag.ContinueOnError)
+	fs.Bool("force", false, "Don't ask for confirmation.")
+	fs.String("name", "", "The name.")
+
+	return &CLI{
+		Name: "app",
+		Commands: map[string]CommandFactory{
+			"foo bar": func() (Command, error) {
+				return &MockCommandFlags{
+					MockCommand: MockCommand{HelpText: "bar help", SynopsisText: "bar"},
+					FlagsValue:  fs,
+				}, nil
+			},
+			"secret": func() (Command, error) {
+				return &MockCommand{HelpText: "secret help", SynopsisText: "secret"}, nil
+			},
+		},
+		HiddenCommands: []string{"secret"},
+	}
+}
+
+func TestCLICommandTree(t *testing.T) {
+	cli := testIntrospectCLI()
+
+	info, err := cli.CommandTree()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if info.Path != "" || info.Name != "app" || info.Help == "" {
+		t.Fatalf("bad: %#v", info)
+	}
+
+	if expected := []string{"-help", "-version"}; !reflect.DeepEqual(info.Flags, expected) {
+		t.Fatalf("bad: %#v", info.Flags)
+	}
+
+	expected := []*CommandInfo{
+		{
+			Path:      "foo",
+			Name:      "foo",
+			Help:      "This command is accessed by using one of the subcommands below.",
+			Generated: true,
+			Flags:     []string{},
+			Subcommands: []*CommandInfo{
+				{
+					Path:        "foo bar",
+					Name:        "bar",
+					Synopsis:    "bar",
+					Help:        "bar help",
+					Flags:       []string{"-force", "-name"},
+					Subcommands: []*CommandInfo{},
+				},
+			},
+		},
+		{
+			Path:        "secret",
+			Name:        "secret",
+			Synopsis:    "secret",
+			Help:        "secret help",
+			Hidden:      true,
+			Flags:       []string{},
+			Subcommands: []*CommandInfo{},
+		},
+	}
+	if !reflect.DeepEqual(info.Subcommands, expected) {
+		actual, _ := json.MarshalIndent(info.Subcommands, "", "  ")
+		t.Fatalf("bad: %s", actual)
+	}
+}
+
+func TestCLICommandTree_error(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return nil, errors.New("nope")
+			},
+		},
+	}
+
+	if _, err := cli.CommandTree(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestCLIRun_helpJSON(t *testing.T) {
+	cases := []struct {
+		Args     []string
+		HelpJSON bool
+		Path     string
+		Code     int
+	}{
+		{[]string{"-help-json"}, true, "", 0},
+		{[]string{"foo", "-help-json"}, true, "foo", 0},
+		{[]string{"foo", "bar", "--help-json"}, true, "foo bar", 0},
+		{[]string{"-help-json"}, false, "", 127},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Path, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			cli := testIntrospectCLI()
+			cli.Args = tc.Args
+			cli.HelpJSON = tc.HelpJSON
+			cli.HelpWriter = buf
+
+			code, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if code != tc.Code {
+				t.Fatalf("bad code: %d", code)
+			}
+
+			if !tc.HelpJSON {
+				return
+			}
+
+			var info CommandInfo
+			if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+				t.Fatalf("err: %s\n\n%s", err, buf.String())
+			}
+
+			if info.Path != tc.Path {
+				t.Fatalf("bad: %#v", info)
+			}
+		})
+	}
+}
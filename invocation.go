@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"flag"
+)
+
+// Invocation is a single run of a CLI with its own arguments. It holds the
+// state of processing the arguments, such as the subcommand and whether
+// help was requested, so that it doesn't have to live in the CLI.
+//
+// An Invocation is created with Invoke.
+type Invocation struct {
+	cli  *CLI
+	args []string
+
+	subcommand     string
+	subcommandErr  error
+	argsErr        error
+	subcommandArgs []string
+	topFlags       []string
+	globalArgs     []string
+
+	// globalFlags is the flag set that the global flags are parsed into
+	// by Run.
+	globalFlags *flag.FlagSet
+
+	// These are true when special global flags are set. We can/should
+	// probably use a bitset for this one day.
+	isHelp                  bool
+	isHelpJSON              bool
+	isHelpAll               bool
+	isVersion               bool
+	isVersionJSON           bool
+	isAutocompleteInstall   bool
+	isAutocompleteUninstall bool
+	isAutocompleteScript    bool
+
+	// autocompleteShell is the shell given to the autocomplete script flag.
+	autocompleteShell string
+
+	// isComplete is true for a request to the hidden complete command, in
+	// which case completeWord is the word that is being completed.
+	isComplete   bool
+	completeWord string
+
+	// ctx is the context of the run and cancel cancels it. They are
+	// created by runContext when the command needs them.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// interactive is true for a line of RunInteractive, in which case
+	// interrupts never exit the process.
+	interactive bool
+}
+
+// Invoke processes args like the Args of the CLI and returns the
+// Invocation that runs the CLI with them. Args itself is ignored and the
+// CLI isn't modified, so a CLI that is configured once can be invoked any
+// number of times, such as for every line of an interactive shell, every
+// request of a server or every case of a table-driven test.
+//
+// Invocations can run at the same time if their commands allow it. With
+// GlobalFlags rather than GlobalFlagsFunc, every run parses the global
+// flags into the same flag set, so such invocations must not overlap.
+// The IsHelp, IsVersion, Subcommand and SubcommandArgs methods of
+// the CLI always describe Args; use the methods of the Invocation instead.
+func (c *CLI) Invoke(args []string) *Invocation {
+	c.once.Do(c.init)
+	return c.newInvocation(args)
+}
+
+// newInvocation processes the args for a new Invocation. The CLI must have
+// been initialized.
+func (c *CLI) newInvocation(args []string) *Invocation {
+	inv := &Invocation{cli: c, args: args}
+
+	// Expand any response files before we look at the args
+	if c.ResponseFiles {
+		expanded, err := expandResponseFiles(args, 0)
+		if err != nil {
+			inv.argsErr = err
+		} else {
+			inv.args = expanded
+		}
+	}
+
+	// A request to the hidden complete command is processed like the
+	// words before the one that is being completed.
+	if c.isCompleteRequest(inv.args) {
+		words := inv.args[1:]
+		if len(words) > 0 {
+			inv.completeWord = words[len(words)-1]
+			words = words[:len(words)-1]
+		}
+
+		inv.isComplete = true
+		inv.args = words
+	}
+
+	inv.processArgs()
+	return inv
+}
+
+// IsHelp returns whether or not the help flag is present within the
+// arguments.
+func (inv *Invocation) IsHelp() bool {
+	return inv.isHelp
+}
+
+// IsVersion returns whether or not the version flag is present within the
+// arguments.
+func (inv *Invocation) IsVersion() bool {
+	return inv.isVersion
+}
+
+// Subcommand returns the subcommand that the invocation would execute.
+func (inv *Invocation) Subcommand() string {
+	return inv.subcommand
+}
+
+// SubcommandArgs returns the arguments that will be passed to the
+// subcommand.
+func (inv *Invocation) SubcommandArgs() []string {
+	return inv.subcommandArgs
+}
+
+// GlobalFlags returns the flag set that the global flags were parsed into
+// by Run, or nil if they weren't parsed.
+func (inv *Invocation) GlobalFlags() *flag.FlagSet {
+	return inv.globalFlags
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCLIInvoke(t *testing.T) {
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Args: []string{"bar"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{HelpText: "foo help", RunResult: 2}, nil
+			},
+			"bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HelpWriter: buf,
+	}
+
+	cases := []struct {
+		Args       []string
+		Subcommand string
+		SubArgs    []string
+		Help       bool
+		Code       int
+	}{
+		{[]string{"foo", "-x", "y"}, "foo", []string{"-x", "y"}, false, 2},
+		{[]string{"foo", "-h"}, "foo", []string{"-h"}, true, 0},
+		{[]string{"bar"}, "bar", []string{}, false, 0},
+		{[]string{"nope"}, "nope", []string{}, false, 127},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			inv := cli.Invoke(tc.Args)
+			if inv.Subcommand() != tc.Subcommand {
+				t.Fatalf("bad: %q", inv.Subcommand())
+			}
+
+			if !reflect.DeepEqual(inv.SubcommandArgs(), tc.SubArgs) {
+				t.Fatalf("bad: %#v", inv.SubcommandArgs())
+			}
+
+			if inv.IsHelp() != tc.Help {
+				t.Fatalf("bad: %v", inv.IsHelp())
+			}
+
+			exitCode, err := inv.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if exitCode != tc.Code {
+				t.Fatalf("bad: %d", exitCode)
+			}
+
+			// The invocation must not change the state of the CLI
+			if cli.Subcommand() != "bar" || cli.IsHelp() {
+				t.Fatalf("bad: %q", cli.Subcommand())
+			}
+		})
+	}
+
+	if !strings.Contains(buf.String(), "foo help") {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestCLIInvoke_concurrent(t *testing.T) {
+	var lock sync.Mutex
+	runArgs := make(map[string][]string)
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return &testFuncCommand{RunFunc: func(args []string) int {
+					lock.Lock()
+					defer lock.Unlock()
+					runArgs[args[0]] = args
+					return 0
+				}}, nil
+			},
+		},
+		HelpWriter: new(bytes.Buffer),
+	}
+
+	var wg sync.WaitGroup
+	for _, arg := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func(arg string) {
+			defer wg.Done()
+			if code, err := cli.Invoke([]string{"foo", "bar", arg}).Run(); code != 0 || err != nil {
+				t.Errorf("bad: %d %v", code, err)
+			}
+		}(arg)
+	}
+	wg.Wait()
+
+	expected := map[string][]string{
+		"a": {"a"},
+		"b": {"b"},
+		"c": {"c"},
+		"d": {"d"},
+	}
+	if !reflect.DeepEqual(runArgs, expected) {
+		t.Fatalf("bad: %#v", runArgs)
+	}
+}
+
+func TestCLIInvoke_globalFlags(t *testing.T) {
+	var chdir string
+	var vars []string
+	var seen []string
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				seen = append(seen, fmt.Sprintf("%s %v", chdir, vars))
+				return new(MockCommand), nil
+			},
+		},
+		GlobalFlagsFunc: func() *flag.FlagSet {
+			vars = nil
+			fs := flag.NewFlagSet("app", flag.ContinueOnError)
+			fs.StringVar(&chdir, "chdir", "", "")
+			fs.Func("var", "", func(v string) error {
+				vars = append(vars, v)
+				return nil
+			})
+			return fs
+		},
+		HelpWriter: new(bytes.Buffer),
+	}
+
+	for _, args := range [][]string{
+		{"-chdir=a", "-var=x", "foo"},
+		{"-chdir", "b", "-var=y", "-var=z", "foo"},
+		{"foo"},
+	} {
+		inv := cli.Invoke(args)
+		if _, err := inv.Run(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if f := inv.GlobalFlags().Lookup("chdir"); f == nil || f.Value.String() != chdir {
+			t.Fatalf("bad: %#v", f)
+		}
+	}
+
+	// The values of an earlier invocation don't carry over
+	expected := []string{"a [x]", "b [y z]", " []"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Fatalf("bad: %#v", seen)
+	}
+}
+
+func TestCLIInvoke_globalFlagsEnv(t *testing.T) {
+	var seen []string
+	cli := &CLI{
+		EnvCommands: map[string]CommandEnvFactory{
+			"foo": func(env *CommandEnv) (Command, error) {
+				seen = append(seen, env.GlobalFlags.Lookup("chdir").Value.String())
+				return new(MockCommand), nil
+			},
+		},
+		GlobalFlagsFunc: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("app", flag.ContinueOnError)
+			fs.String("chdir", "", "")
+			return fs
+		},
+		HelpWriter: new(bytes.Buffer),
+	}
+
+	// Every invocation parses into a flag set of its own
+	a := cli.Invoke([]string{"-chdir=a", "foo"})
+	b := cli.Invoke([]string{"-chdir=b", "foo"})
+	for _, inv := range []*Invocation{a, b} {
+		if _, err := inv.Run(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if a.GlobalFlags() == b.GlobalFlags() || a.GlobalFlags() == cli.GlobalFlags {
+		t.Fatal("flag sets should differ")
+	}
+
+	if !reflect.DeepEqual(seen, []string{"a", "b"}) {
+		t.Fatalf("bad: %#v", seen)
+	}
+
+	// The flag set of the CLI lists the flags in the help
+	if cli.GlobalFlags.Lookup("chdir") == nil {
+		t.Fatal("chdir should be declared")
+	}
+}
+
+// testFuncCommand is a command that runs a function.
+type testFuncCommand struct {
+	MockCommand
+
+	RunFunc func(args []string) int
+}
+
+func (c *testFuncCommand) Run(args []string) int {
+	return c.RunFunc(args)
+}
@@ -0,0 +1,312 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manSection is the man page section that the pages are written for,
+// which is the section for user commands.
+const manSection = "1"
+
+// ManPages writes a roff man page for the CLI and for each of its visible
+// subcommands into the directory dir, which is created if it doesn't
+// exist. The page for the CLI itself is named "<Name>.1" and lists the
+// commands of the CLI. The page for a subcommand such as "foo bar" is named
+// "<Name>-foo-bar.1" and contains its synopsis, help and subcommands.
+//
+// Hidden commands and the commands underneath them don't get a page and
+// aren't listed. Name must be set.
+func (c *CLI) ManPages(dir string) error {
+	c.once.Do(c.init)
+
+	if c.Name == "" {
+		return errors.New("cli: Name must be set to generate man pages")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, k := range append([]string{""}, c.visibleCommands()...) {
+		var buf bytes.Buffer
+		if err := c.WriteManPage(&buf, k); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, c.manPageName(k)+"."+manSection)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteManPage writes the roff man page for the command with the given
+// full name, such as "foo bar", to w. The empty name writes the page for
+// the CLI itself. See ManPages.
+func (c *CLI) WriteManPage(w io.Writer, name string) error {
+	c.once.Do(c.init)
+
+	if c.Name == "" {
+		return errors.New("cli: Name must be set to generate man pages")
+	}
+
+	if name == "" {
+		_, err := io.WriteString(w, c.rootManPage())
+		return err
+	}
+
+	raw, ok := c.commandTree.Get(name)
+	if !ok || c.hiddenPath(name) {
+		return fmt.Errorf("cli: command not found: %s", name)
+	}
+
+	command, err := raw.(CommandFactory)()
+	if err != nil {
+		return fmt.Errorf("cli: command %q failed to load: %s", name, err)
+	}
+
+	_, err = io.WriteString(w, c.commandManPage(name, command))
+	return err
+}
+
+// rootManPage returns the man page for the CLI itself.
+func (c *CLI) rootManPage() string {
+	var buf bytes.Buffer
+	c.writeManHeader(&buf, "")
+
+	buf.WriteString(".SH NAME\n")
+	buf.WriteString(roffEscape(c.Name) + "\n")
+
+	buf.WriteString(".SH SYNOPSIS\n")
+	buf.WriteString(".B " + roffEscape(c.Name) + "\n")
+	buf.WriteString(roffEscape("[--version] [--help] <command> [<args>]") + "\n")
+
+	if c.GlobalFlags != nil {
+		c.writeManFlags(&buf, "GLOBAL OPTIONS", c.GlobalFlags)
+	}
+
+	c.writeManCommands(&buf, "COMMANDS", "")
+	c.writeManSeeAlso(&buf, "")
+	return buf.String()
+}
+
+// commandManPage returns the man page for the given command.
+func (c *CLI) commandManPage(name string, command Command) string {
+	var buf bytes.Buffer
+	c.writeManHeader(&buf, name)
+
+	buf.WriteString(".SH NAME\n")
+	buf.WriteString(roffEscape(c.manPageName(name)))
+	if synopsis := strings.TrimSpace(command.Synopsis()); synopsis != "" {
+		buf.WriteString(" " + roffEscape("- "+synopsis))
+	}
+	buf.WriteString("\n")
+
+	buf.WriteString(".SH SYNOPSIS\n")
+	buf.WriteString(".B " + roffEscape(c.Name+" "+name) + "\n")
+	buf.WriteString(roffEscape("[<args>]") + "\n")
+
+	if help := strings.TrimSpace(command.Help()); help != "" {
+		// The help text is usually formatted for a terminal already, so
+		// it is kept as is rather than filled by the formatter.
+		buf.WriteString(".SH DESCRIPTION\n")
+		buf.WriteString(".nf\n")
+		for _, line := range strings.Split(help, "\n") {
+			buf.WriteString(roffEscape(line) + "\n")
+		}
+		buf.WriteString(".fi\n")
+	}
+
+	if f, ok := command.(CommandFlags); ok {
+		if fs := f.Flags(); fs != nil {
+			c.writeManFlags(&buf, "OPTIONS", fs)
+		}
+	}
+
+	if d, ok := c.DeprecatedCommands[name]; ok {
+		buf.WriteString(".SH DEPRECATED\n")
+		buf.WriteString(".nf\n")
+		for _, line := range strings.Split(d.warning(name, c.Version), "\n") {
+			buf.WriteString(roffEscape(line) + "\n")
+		}
+		buf.WriteString(".fi\n")
+	}
+
+	c.writeManCommands(&buf, "SUBCOMMANDS", name)
+	c.writeManSeeAlso(&buf, name)
+	return buf.String()
+}
+
+// writeManHeader writes the title line of the page for the given command.
+func (c *CLI) writeManHeader(buf *bytes.Buffer, name string) {
+	source := c.Name
+	if c.Version != "" {
+		source += " " + c.Version
+	}
+
+	buf.WriteString(fmt.Sprintf(".TH \"%s\" \"%s\" \"\" \"%s\" \"%s\"\n",
+		roffEscape(strings.ToUpper(c.manPageName(name))),
+		manSection,
+		roffEscape(source),
+		roffEscape(c.Name+" Manual")))
+}
+
+// writeManFlags writes a section with the given title that lists the flags
+// of fs, if there are any.
+func (c *CLI) writeManFlags(buf *bytes.Buffer, title string, fs *flag.FlagSet) {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	if len(flags) == 0 {
+		return
+	}
+
+	buf.WriteString(".SH " + title + "\n")
+	for _, f := range flags {
+		valueName, usage := flag.UnquoteUsage(f)
+		name := "-" + f.Name
+		if valueName != "" {
+			name += "=" + valueName
+		}
+
+		if f.DefValue != "" && f.DefValue != "0" && f.DefValue != "false" {
+			usage = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", usage, f.DefValue))
+		}
+
+		buf.WriteString(".TP\n")
+		buf.WriteString(".B " + roffEscape(name) + "\n")
+		buf.WriteString(roffEscape(usage) + "\n")
+	}
+}
+
+// writeManCommands writes a section with the given title that lists the
+// visible subcommands directly underneath parent, if there are any.
+func (c *CLI) writeManCommands(buf *bytes.Buffer, title, parent string) {
+	commands := c.helpCommands(parent, false)
+	if len(commands) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(commands))
+	for k := range commands {
+		// The default command is documented by the page of the CLI
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	buf.WriteString(".SH " + title + "\n")
+	for _, k := range keys {
+		command, err := commands[k]()
+		if err != nil {
+			continue
+		}
+
+		buf.WriteString(".TP\n")
+		buf.WriteString(".B " + roffEscape(strings.TrimPrefix(k, parent+" ")) + "\n")
+		buf.WriteString(roffEscape(strings.TrimSpace(command.Synopsis())) + "\n")
+	}
+}
+
+// writeManSeeAlso writes the section that refers to the pages of the
+// parents of the given command and of its visible subcommands.
+func (c *CLI) writeManSeeAlso(buf *bytes.Buffer, name string) {
+	var refs []string
+	if name != "" {
+		refs = append(refs, "")
+		words := strings.Split(name, " ")
+		for i := 1; i < len(words); i++ {
+			refs = append(refs, strings.Join(words[:i], " "))
+		}
+	}
+
+	var keys []string
+	for k := range c.helpCommands(name, false) {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	refs = append(refs, keys...)
+
+	if len(refs) == 0 {
+		return
+	}
+
+	buf.WriteString(".SH SEE ALSO\n")
+	for i, ref := range refs {
+		line := fmt.Sprintf(".BR %s (%s)", roffEscape(c.manPageName(ref)), manSection)
+		if i < len(refs)-1 {
+			line += ","
+		}
+		buf.WriteString(line + "\n")
+	}
+}
+
+// visibleCommands returns the sorted full names of all the commands that
+// aren't hidden, including those that are deprecated. The default command
+// isn't included since it has no name of its own.
+func (c *CLI) visibleCommands() []string {
+	var result []string
+	c.commandTree.Walk(func(k string, raw interface{}) bool {
+		if k != "" && !c.hiddenPath(k) {
+			result = append(result, k)
+		}
+
+		return false
+	})
+
+	sort.Strings(result)
+	return result
+}
+
+// hiddenPath returns true if the command or any of its parents is hidden.
+func (c *CLI) hiddenPath(name string) bool {
+	words := strings.Split(name, " ")
+	for i := range words {
+		if _, ok := c.commandHidden[strings.Join(words[:i+1], " ")]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// manPageName returns the name of the man page for the given command,
+// such as "app-foo-bar" for "foo bar".
+func (c *CLI) manPageName(name string) string {
+	if name == "" {
+		return c.Name
+	}
+
+	return c.Name + "-" + strings.Replace(name, " ", "-", -1)
+}
+
+// roffEscape escapes s so it is shown literally by roff.
+func roffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+
+	// Lines that start with a period or apostrophe are control lines.
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+
+	return s
+}
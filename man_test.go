@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCLIManPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		Name:    "app",
+		Version: "1.0.0",
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{HelpText: "foo", SynopsisText: "foo"}, nil
+			},
+			"foo bar": func() (Command, error) {
+				return &MockCommand{HelpText: "bar", SynopsisText: "bar"}, nil
+			},
+			"secret": func() (Command, error) {
+				return &MockCommand{HelpText: "secret", SynopsisText: "secret"}, nil
+			},
+			"secret sauce": func() (Command, error) {
+				return &MockCommand{HelpText: "sauce", SynopsisText: "sauce"}, nil
+			},
+			"baz qux": func() (Command, error) {
+				return &MockCommand{HelpText: "qux", SynopsisText: "qux"}, nil
+			},
+		},
+		HiddenCommands: []string{"secret"},
+	}
+
+	if err := cli.ManPages(dir); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual []string
+	for _, info := range infos {
+		actual = append(actual, info.Name())
+	}
+	sort.Strings(actual)
+
+	expected := []string{"app-baz-qux.1", "app-baz.1", "app-foo-bar.1", "app-foo.1", "app.1"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "app.1"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.Contains(string(contents), "secret") {
+		t.Fatalf("bad: %s", contents)
+	}
+}
+
+func TestCLIManPages_defaultCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{
+		Name: "app",
+		Commands: map[string]CommandFactory{
+			"": func() (Command, error) {
+				return &MockCommand{HelpText: "default", SynopsisText: "default"}, nil
+			},
+			"foo": func() (Command, error) {
+				return &MockCommand{HelpText: "foo", SynopsisText: "foo"}, nil
+			},
+		},
+	}
+
+	if err := cli.ManPages(dir); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var actual []string
+	for _, info := range infos {
+		actual = append(actual, info.Name())
+	}
+	sort.Strings(actual)
+
+	expected := []string{"app-foo.1", "app.1"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "app.1"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(contents), ".B foo\n") || strings.Contains(string(contents), ".B \n") {
+		t.Fatalf("bad: %s", contents)
+	}
+	if strings.Contains(string(contents), ".BR app (1)") {
+		t.Fatalf("bad: %s", contents)
+	}
+}
+
+func TestCLIWriteManPage_root(t *testing.T) {
+	fs := flag.NewFlagSet("global", flag.ContinueOnError)
+	fs.String("chdir", "", "Switch to a different `DIR`.")
+
+	cli := &CLI{
+		Name:    "app",
+		Version: "1.0.0",
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Does foo."}, nil
+			},
+			"bar-baz": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Does bar."}, nil
+			},
+		},
+		GlobalFlags: fs,
+	}
+
+	var buf bytes.Buffer
+	if err := cli.WriteManPage(&buf, ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `.TH "APP" "1" "" "app 1.0.0" "app Manual"
+.SH NAME
+app
+.SH SYNOPSIS
+.B app
+[\-\-version] [\-\-help] <command> [<args>]
+.SH GLOBAL OPTIONS
+.TP
+.B \-chdir=DIR
+Switch to a different DIR.
+.SH COMMANDS
+.TP
+.B bar\-baz
+Does bar.
+.TP
+.B foo
+Does foo.
+.SH SEE ALSO
+.BR app\-bar\-baz (1),
+.BR app\-foo (1)
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestCLIWriteManPage_subcommand(t *testing.T) {
+	fs := flag.NewFlagSet("bar", flag.ContinueOnError)
+	fs.Bool("force", false, "Don't ask for confirmation.")
+
+	cli := &CLI{
+		Name: "app",
+		Commands: map[string]CommandFactory{
+			"foo bar": func() (Command, error) {
+				return &MockCommandFlags{
+					MockCommand: MockCommand{
+						HelpText:     "Usage: app foo bar\n\n.Does\\bar.",
+						SynopsisText: "Does bar.",
+					},
+					FlagsValue: fs,
+				}, nil
+			},
+			"foo bar baz": func() (Command, error) {
+				return &MockCommand{SynopsisText: "Does baz."}, nil
+			},
+		},
+		DeprecatedCommands: map[string]Deprecation{
+			"foo bar": {Replacement: "foo qux"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := cli.WriteManPage(&buf, "foo bar"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := `.TH "APP\-FOO\-BAR" "1" "" "app" "app Manual"
+.SH NAME
+app\-foo\-bar \- Does bar.
+.SH SYNOPSIS
+.B app foo bar
+[<args>]
+.SH DESCRIPTION
+.nf
+Usage: app foo bar
+
+\&.Does\ebar.
+.fi
+.SH OPTIONS
+.TP
+.B \-force
+Don't ask for confirmation.
+.SH DEPRECATED
+.nf
+Warning: The "foo bar" command is deprecated. Use "foo qux" instead.
+.fi
+.SH SUBCOMMANDS
+.TP
+.B baz
+Does baz.
+.SH SEE ALSO
+.BR app (1),
+.BR app\-foo (1),
+.BR app\-foo\-bar\-baz (1)
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: %s", buf.String())
+	}
+}
+
+func TestCLIWriteManPage_hidden(t *testing.T) {
+	cli := &CLI{
+		Name: "app",
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"foo bar": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		HiddenCommands: []string{"foo"},
+	}
+
+	var buf bytes.Buffer
+	for _, name := range []string{"foo", "foo bar", "nope"} {
+		if err := cli.WriteManPage(&buf, name); err == nil {
+			t.Fatalf("should error: %s", name)
+		}
+	}
+}
+
+func TestCLIWriteManPage_noName(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := cli.WriteManPage(&buf, ""); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+// ParseResult describes what running the CLI with a set of arguments would
+// do. See Parse.
+type ParseResult struct {
+	// Subcommand is the full name of the subcommand that would run, with
+	// aliases and abbreviations resolved, such as "state show". It is
+	// empty if no subcommand was given. The subcommand may not exist, in
+	// which case running the CLI shows the help and exits with 127.
+	Subcommand string
+
+	// SubcommandArgs are the arguments that would be given to the
+	// subcommand, including any default arguments from the environment.
+	SubcommandArgs []string
+
+	// DefaultCommand is true if the default command "" would run because
+	// no subcommand was given.
+	DefaultCommand bool
+
+	// TopFlags are the flags before the subcommand that the CLI doesn't
+	// know. Running a subcommand with such flags is an error. The default
+	// command receives them as part of SubcommandArgs instead.
+	TopFlags []string
+
+	// GlobalArgs are the declared GlobalFlags along with their values as
+	// they were given. They aren't parsed into the flag set.
+	GlobalArgs []string
+
+	// These are true if the corresponding special flag was given. HelpAll
+	// is only true along with Help.
+	Help     bool
+	HelpAll  bool
+	HelpJSON bool
+	Version  bool
+
+	// AutocompleteInstall, AutocompleteUninstall and AutocompleteScript are
+	// true if the autocomplete flags were given. AutocompleteShell is the
+	// shell given to the script flag.
+	AutocompleteInstall   bool
+	AutocompleteUninstall bool
+	AutocompleteScript    bool
+	AutocompleteShell     string
+
+	// Complete is true for a request to the hidden "__complete" command.
+	// The other fields then describe the words before CompleteWord, which
+	// is the word that is being completed.
+	Complete     bool
+	CompleteWord string
+}
+
+// Parse processes args like Run would and returns what running the CLI
+// with them would do, without running anything. No command factory is
+// called and the GlobalFlags aren't parsed. This lets wrappers and other
+// tooling find out which command a set of arguments maps to.
+//
+// An error is returned if the arguments can't be processed, such as when
+// a response file can't be read or an abbreviation is ambiguous.
+func (c *CLI) Parse(args []string) (*ParseResult, error) {
+	return c.Invoke(args).parseResult()
+}
+
+// parseResult returns the result of processing the args of the
+// invocation.
+func (inv *Invocation) parseResult() (*ParseResult, error) {
+	if inv.argsErr != nil {
+		return nil, inv.argsErr
+	}
+	if inv.subcommandErr != nil {
+		return nil, inv.subcommandErr
+	}
+
+	result := &ParseResult{
+		Subcommand:            inv.subcommand,
+		SubcommandArgs:        inv.subcommandArgs,
+		TopFlags:              inv.topFlags,
+		GlobalArgs:            inv.globalArgs,
+		Help:                  inv.isHelp,
+		HelpAll:               inv.isHelpAll,
+		HelpJSON:              inv.isHelpJSON,
+		Version:               inv.isVersion,
+		AutocompleteInstall:   inv.isAutocompleteInstall,
+		AutocompleteUninstall: inv.isAutocompleteUninstall,
+		AutocompleteScript:    inv.isAutocompleteScript,
+		AutocompleteShell:     inv.autocompleteShell,
+		Complete:              inv.isComplete,
+		CompleteWord:          inv.completeWord,
+	}
+
+	if inv.subcommand == "" {
+		_, result.DefaultCommand = inv.cli.commandTree.Get("")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCLIParse(t *testing.T) {
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	chdir := fs.String("chdir", "", "")
+
+	// Parsing must never create a command
+	factory := func() (Command, error) {
+		panic("factory called")
+	}
+
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"":           factory,
+			"state list": factory,
+			"state show": factory,
+			"status":     factory,
+		},
+		Aliases:       map[string]string{"ls": "state list"},
+		Abbreviations: true,
+		GlobalFlags:   fs,
+	}
+
+	cases := []struct {
+		Args     []string
+		Expected *ParseResult
+	}{
+		{
+			[]string{"state", "show", "-x", "foo"},
+			&ParseResult{
+				Subcommand:     "state show",
+				SubcommandArgs: []string{"-x", "foo"},
+			},
+		},
+		{
+			[]string{"-chdir", "dir", "ls", "-h", "-all"},
+			&ParseResult{
+				Subcommand:     "state list",
+				SubcommandArgs: []string{"-h", "-all"},
+				GlobalArgs:     []string{"-chdir", "dir"},
+				Help:           true,
+				HelpAll:        true,
+			},
+		},
+		{
+			[]string{"statu", "sh"},
+			&ParseResult{
+				Subcommand:     "status",
+				SubcommandArgs: []string{"sh"},
+			},
+		},
+		{
+			[]string{"-x", "-version"},
+			&ParseResult{
+				SubcommandArgs: []string{"-x"},
+				DefaultCommand: true,
+				Version:        true,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			actual, err := cli.Parse(tc.Args)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+
+	// The global flags are kept as they were given
+	if *chdir != "" {
+		t.Fatalf("bad: %q", *chdir)
+	}
+}
+
+func TestCLIParse_noDefault(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+	}
+
+	cases := []struct {
+		Args     []string
+		Expected *ParseResult
+	}{
+		{
+			[]string{"-x", "foo", "-y"},
+			&ParseResult{
+				Subcommand:     "foo",
+				SubcommandArgs: []string{"-y"},
+				TopFlags:       []string{"-x"},
+			},
+		},
+		{
+			[]string{"nope", "-x"},
+			&ParseResult{
+				Subcommand:     "nope",
+				SubcommandArgs: []string{"-x"},
+			},
+		},
+		{
+			[]string{"-h"},
+			&ParseResult{Help: true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			actual, err := cli.Parse(tc.Args)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad: %#v", actual)
+			}
+		})
+	}
+}
+
+func TestCLIParse_error(t *testing.T) {
+	cli := &CLI{
+		Commands: map[string]CommandFactory{
+			"status": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+			"state": func() (Command, error) {
+				return new(MockCommand), nil
+			},
+		},
+		Abbreviations: true,
+		ResponseFiles: true,
+	}
+
+	for _, args := range [][]string{
+		{"st"},
+		{"@does-not-exist"},
+	} {
+		actual, err := cli.Parse(args)
+		if err == nil {
+			t.Fatalf("%#v: should error: %#v", args, actual)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pluginSynopsisTimeout is the maximum amount of time to wait for a plugin
+// to output its synopsis or help.
+const pluginSynopsisTimeout = 5 * time.Second
+
+// discoverPlugins returns the plugins found in the plugin directories as a
+// mapping of subcommand name to the path of the executable.
+func (c *CLI) discoverPlugins() map[string]string {
+	if c.Name == "" {
+		return nil
+	}
+
+	dirs := c.PluginDirs
+	if c.PluginPath {
+		dirs = append(dirs[:len(dirs):len(dirs)], filepath.SplitList(os.Getenv("PATH"))...)
+	}
+
+	prefix := c.Name + "-"
+	result := make(map[string]string)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+
+		// Unreadable directories are common on $PATH, so just skip them
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, fi := range entries {
+			name := fi.Name()
+			if !strings.HasPrefix(name, prefix) || !isExecutable(fi) {
+				continue
+			}
+
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+
+			sub := name[len(prefix):]
+			if sub == "" || strings.ContainsAny(sub, " \t") {
+				continue
+			}
+
+			if _, ok := result[sub]; !ok {
+				result[sub] = filepath.Join(dir, fi.Name())
+			}
+		}
+	}
+
+	return result
+}
+
+// isExecutable returns true if the file is a regular file that can be
+// executed.
+func isExecutable(fi os.FileInfo) bool {
+	if !fi.Mode().IsRegular() {
+		return false
+	}
+
+	if runtime.GOOS != "windows" {
+		return fi.Mode().Perm()&0111 != 0
+	}
+
+	exts := os.Getenv("PATHEXT")
+	if exts == "" {
+		exts = ".com;.exe;.bat;.cmd"
+	}
+
+	ext := strings.ToLower(filepath.Ext(fi.Name()))
+	for _, e := range filepath.SplitList(strings.ToLower(exts)) {
+		if e != "" && e == ext {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pluginCommandFactory returns a CommandFactory for the plugin at path.
+func pluginCommandFactory(path string) CommandFactory {
+	return func() (Command, error) {
+		return &pluginCommand{Path: path}, nil
+	}
+}
+
+// pluginCommand is a Command that runs an external executable.
+type pluginCommand struct {
+	Path string
+}
+
+func (c *pluginCommand) Help() string {
+	out, err := c.output("--help")
+	if err != nil && out == "" {
+		return fmt.Sprintf("Error getting help for plugin %s: %s", c.Path, err)
+	}
+
+	return out
+}
+
+// Run runs the plugin and waits for it to exit. The plugin is in the same
+// process group, so it receives an interrupt from the terminal as well.
+// The CLI doesn't exit on an interrupt while the plugin runs, so that the
+// plugin isn't left running, and passes a termination signal on to it.
+func (c *pluginCommand) Run(args []string) int {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	cmd := exec.Command(c.Path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Start()
+	if err == nil {
+		doneCh := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case sig := <-sigCh:
+					if sig != os.Interrupt {
+						cmd.Process.Signal(sig)
+					}
+				case <-doneCh:
+					return
+				}
+			}
+		}()
+
+		err = cmd.Wait()
+		close(doneCh)
+	}
+
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+
+	fmt.Fprintf(os.Stderr, "Error running plugin %s: %s\n", c.Path, err)
+	return 1
+}
+
+func (c *pluginCommand) Synopsis() string {
+	sidecar := strings.TrimSuffix(c.Path, filepath.Ext(c.Path))
+	if runtime.GOOS != "windows" {
+		sidecar = c.Path
+	}
+
+	if data, err := ioutil.ReadFile(sidecar + ".synopsis"); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+
+	out, err := c.output("--synopsis")
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(out)
+}
+
+// output runs the plugin with the given argument and returns what it
+// writes to stdout and stderr.
+func (c *pluginCommand) output(arg string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginSynopsisTimeout)
+	defer cancel()
+
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, arg)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	return buf.String(), err
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCLIRun_plugin(t *testing.T) {
+	dir := testPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	os.Setenv("PLUGIN_OUT", out)
+	defer os.Unsetenv("PLUGIN_OUT")
+
+	cli := &CLI{
+		Name:       "app",
+		Args:       []string{"hello", "a", "-b"},
+		PluginDirs: []string{dir},
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 3 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if string(data) != "a -b\n" {
+		t.Fatalf("bad args: %q", data)
+	}
+}
+
+func TestCLIRun_pluginSignals(t *testing.T) {
+	dir := testPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	// The plugin exits once it is terminated
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\ntrap 'exit 5' TERM\ntouch \"$PLUGIN_OUT\"\nwhile :; do sleep 0.01; done\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "app-wait"), []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	os.Setenv("PLUGIN_OUT", out)
+	defer os.Unsetenv("PLUGIN_OUT")
+
+	go func() {
+		for {
+			if _, err := os.Stat(out); err == nil {
+				break
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		// Interrupts don't make the CLI leave the plugin running
+		testSignal(t)
+		testSignal(t)
+		time.Sleep(50 * time.Millisecond)
+
+		p, _ := os.FindProcess(os.Getpid())
+		p.Signal(syscall.SIGTERM)
+	}()
+
+	exitCh := make(chan int, 1)
+	cli := &CLI{
+		Name:                 "app",
+		Args:                 []string{"wait"},
+		PluginDirs:           []string{dir},
+		InterruptGracePeriod: time.Millisecond,
+		ErrorWriter:          new(bytes.Buffer),
+		exitFunc:             func(code int) { exitCh <- code },
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 5 {
+		t.Fatalf("bad: %d", exitCode)
+	}
+
+	select {
+	case <-exitCh:
+		t.Fatal("exit should not be called")
+	default:
+	}
+}
+
+func TestCLIRun_pluginPrecedence(t *testing.T) {
+	dir := testPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	command := new(MockCommand)
+	cli := &CLI{
+		Name: "app",
+		Args: []string{"hello"},
+		Commands: map[string]CommandFactory{
+			"hello": func() (Command, error) {
+				return command, nil
+			},
+		},
+		PluginDirs: []string{dir},
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !command.RunCalled {
+		t.Fatalf("run should be called")
+	}
+}
+
+func TestCLIRun_pluginPath(t *testing.T) {
+	dir := testPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	for _, pluginPath := range []bool{false, true} {
+		cli := &CLI{Name: "app", Args: []string{"hello"}, PluginPath: pluginPath}
+		cli.Subcommand()
+
+		if _, ok := cli.commandTree.Get("hello"); ok != pluginPath {
+			t.Fatalf("PluginPath %v: plugin found: %v", pluginPath, ok)
+		}
+	}
+}
+
+func TestCLIRun_printHelpPlugins(t *testing.T) {
+	dir := testPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Name: "app",
+		Args: []string{"-h"},
+		Commands: map[string]CommandFactory{
+			"foo": func() (Command, error) {
+				return &MockCommand{SynopsisText: "hi!"}, nil
+			},
+		},
+		HiddenCommands: []string{"secret"},
+		PluginDirs:     []string{dir},
+		HelpWriter:     buf,
+	}
+
+	exitCode, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exitCode != 0 {
+		t.Fatalf("bad exit code: %d", exitCode)
+	}
+
+	expected := `Usage: app [--version] [--help] <command> [<args>]
+
+Available commands are:
+    foo      hi!
+    hello    Says hello.
+    world    Says world.
+
+`
+	if buf.String() != expected {
+		t.Fatalf("bad: %#v\n\n%#v", buf.String(), expected)
+	}
+}
+
+func TestCLIRun_printCommandHelpPlugin(t *testing.T) {
+	dir := testPluginDir(t)
+	defer os.RemoveAll(dir)
+
+	buf := new(bytes.Buffer)
+	cli := &CLI{
+		Name:       "app",
+		Args:       []string{"hello", "-h"},
+		PluginDirs: []string{dir},
+		HelpWriter: buf,
+	}
+
+	if _, err := cli.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "Usage: app hello") {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
+
+// testPluginDir creates a directory of plugins for the CLI "app" and
+// returns its path. The "hello" plugin writes its arguments to the file
+// in $PLUGIN_OUT and exits with status 3.
+func testPluginDir(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin tests use shell scripts")
+	}
+
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	files := map[string]string{
+		"app-hello": `#!/bin/sh
+case "$1" in
+--help) echo "Usage: app hello"; exit 0;;
+--synopsis) echo "Says hello."; exit 0;;
+esac
+echo "$@" > "$PLUGIN_OUT"
+exit 3
+`,
+		"app-world":          "#!/bin/sh\nexit 1\n",
+		"app-world.synopsis": "Says world.\n",
+		"app-secret":         "#!/bin/sh\nexit 1\n",
+		"app-noexec":         "#!/bin/sh\nexit 1\n",
+		"other-hello":        "#!/bin/sh\nexit 1\n",
+	}
+
+	for name, contents := range files {
+		mode := os.FileMode(0755)
+		if strings.HasSuffix(name, ".synopsis") || name == "app-noexec" {
+			mode = 0644
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), mode); err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	return dir
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"sync"
+
+	"github.com/posener/complete"
+)
+
+// CommandSpec is a command along with static metadata about it, so that
+// the CLI can list and autocomplete the command without creating it. See
+// CLI.CommandSpecs.
+type CommandSpec struct {
+	// Factory creates the command. It is only called to run the command
+	// or to show its help.
+	Factory CommandFactory
+
+	// Synopsis is shown for the command in the help output and in
+	// completions instead of the Synopsis of the command.
+	Synopsis string
+
+	// Help is the Help of the command in the help template data of its
+	// parent command, see CommandHelpTemplate. The help of the command
+	// itself still comes from the command.
+	Help string
+
+	// Hidden hides the command, like listing it in HiddenCommands.
+	Hidden bool
+
+	// Category is the category the command is listed under, like the
+	// Category of a command that implements CommandCategory. The
+	// Categories of the CLI take precedence.
+	Category string
+
+	// AutocompleteArgs and AutocompleteFlags are used to autocomplete the
+	// command instead of the ones of a command that implements
+	// CommandAutocomplete or CommandFlags. Either may be nil.
+	AutocompleteArgs  complete.Predictor
+	AutocompleteFlags complete.Flags
+}
+
+// listFactory returns the factory for listing the command with the given
+// full key, which doesn't create the command if it has a spec.
+func (c *CLI) listFactory(k string, f CommandFactory) CommandFactory {
+	if spec, ok := c.commandSpecs[k]; ok {
+		return specCommandFactory(spec)
+	}
+
+	return f
+}
+
+// specCommandFactory returns a CommandFactory for listing the command of
+// the spec. The commands it creates answer from the spec, and only create
+// the real command if they are run.
+func specCommandFactory(spec *CommandSpec) CommandFactory {
+	return func() (Command, error) {
+		return &specCommand{spec: spec}, nil
+	}
+}
+
+// specCommand stands in for the command of a CommandSpec.
+type specCommand struct {
+	spec *CommandSpec
+
+	once    sync.Once
+	command Command
+	err     error
+}
+
+// impl creates the real command once.
+func (c *specCommand) impl() (Command, error) {
+	c.once.Do(func() {
+		c.command, c.err = c.spec.Factory()
+	})
+
+	return c.command, c.err
+}
+
+func (c *specCommand) Help() string {
+	return c.spec.Help
+}
+
+func (c *specCommand) Run(args []string) int {
+	command, err := c.impl()
+	if err != nil {
+		return 1
+	}
+
+	return command.Run(args)
+}
+
+func (c *specCommand) Synopsis() string {
+	return c.spec.Synopsis
+}
+
+func (c *specCommand) Category() string {
+	return c.spec.Category
+}
@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/posener/complete"
+)
+
+// testSpecCLI returns a CLI with commands that have specs and records
+// which of their factories are called.
+func testSpecCLI(called map[string]bool) *CLI {
+	factory := func(name string) CommandFactory {
+		return func() (Command, error) {
+			called[name] = true
+			return &MockCommand{HelpText: name + " help", SynopsisText: "real synopsis"}, nil
+		}
+	}
+
+	return &CLI{
+		Name: "app",
+		Commands: map[string]CommandFactory{
+			"plain": factory("plain"),
+		},
+		CommandSpecs: map[string]CommandSpec{
+			"apply": {
+				Factory:          factory("apply"),
+				Synopsis:         "Apply the changes",
+				Category:         "Main commands",
+				AutocompleteArgs: complete.PredictSet("prod", "staging"),
+				AutocompleteFlags: complete.Flags{
+					"-auto-approve": complete.PredictNothing,
+				},
+			},
+			"state list": {
+				Factory:  factory("state list"),
+				Synopsis: "List the resources",
+				Help:     " Lists the resources.\n",
+			},
+			"secret": {
+				Factory: factory("secret"),
+				Hidden:  true,
+			},
+			"plain": {
+				Factory:  factory("spec plain"),
+				Synopsis: "Overridden",
+			},
+		},
+	}
+}
+
+func TestCLIRun_specHelp(t *testing.T) {
+	called := make(map[string]bool)
+	buf := new(bytes.Buffer)
+	cli := testSpecCLI(called)
+	cli.Args = []string{"-h"}
+	cli.HelpFunc = CategorizedHelpFunc("app", nil)
+	cli.HelpWriter = buf
+
+	code, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if code != 0 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	expected := []string{"Main commands:", "apply    Apply the changes", "plain    real synopsis"}
+	for _, s := range expected {
+		if !strings.Contains(buf.String(), s) {
+			t.Fatalf("missing %q:\n\n%s", s, buf.String())
+		}
+	}
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("bad:\n\n%s", buf.String())
+	}
+
+	// Only the command without a spec had to be created
+	if !reflect.DeepEqual(called, map[string]bool{"plain": true}) {
+		t.Fatalf("bad: %#v", called)
+	}
+}
+
+func TestCLIRun_specCommand(t *testing.T) {
+	cases := []struct {
+		Args []string
+		Help string
+	}{
+		{[]string{"state", "list"}, ""},
+		{[]string{"state", "list", "-h"}, "state list help"},
+		{[]string{"secret"}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			called := make(map[string]bool)
+			buf := new(bytes.Buffer)
+			cli := testSpecCLI(called)
+			cli.Args = tc.Args
+			cli.HelpWriter = buf
+
+			code, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if code != 0 {
+				t.Fatalf("bad: %d", code)
+			}
+
+			name := strings.Join(tc.Args, " ")
+			name = strings.TrimSuffix(name, " -h")
+			if !reflect.DeepEqual(called, map[string]bool{name: true}) {
+				t.Fatalf("bad: %#v", called)
+			}
+
+			if !strings.Contains(buf.String(), tc.Help) {
+				t.Fatalf("bad: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestCLIRun_specParentHelp(t *testing.T) {
+	cases := []struct {
+		Template string
+		Expected string
+		Called   map[string]bool
+	}{
+		{
+			"",
+			"list    List the resources",
+			map[string]bool{"state": true},
+		},
+		{
+			"{{range .Subcommands}}{{.Name}}: {{.Help | trim}}{{end}}",
+			"list: Lists the resources.",
+			map[string]bool{"state": true},
+		},
+		{
+			`{{range .Subcommands}}{{if eq .Help " Lists the resources.\n"}}same{{end}}{{end}}`,
+			"same",
+			map[string]bool{"state": true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Template, func(t *testing.T) {
+			called := make(map[string]bool)
+			buf := new(bytes.Buffer)
+			cli := testSpecCLI(called)
+			cli.Args = []string{"state", "-h"}
+			cli.Commands["state"] = func() (Command, error) {
+				called["state"] = true
+				command := MockCommand{HelpText: "state help"}
+				if tc.Template == "" {
+					return &command, nil
+				}
+
+				return &MockCommandHelpTemplate{
+					MockCommand:      command,
+					HelpTemplateText: tc.Template,
+				}, nil
+			}
+			cli.HelpWriter = buf
+
+			code, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if code != 0 {
+				t.Fatalf("bad: %d", code)
+			}
+
+			if !strings.Contains(buf.String(), tc.Expected) {
+				t.Fatalf("bad: %s", buf.String())
+			}
+
+			// The help of the subcommands comes from their specs
+			if !reflect.DeepEqual(called, tc.Called) {
+				t.Fatalf("bad: %#v", called)
+			}
+		})
+	}
+}
+
+func TestCLIAutocomplete_spec(t *testing.T) {
+	cases := []struct {
+		Completed []string
+		Last      string
+		Expected  []string
+	}{
+		{[]string{}, "", []string{"apply", "plain", "state"}},
+		{[]string{"apply"}, "", []string{"prod", "staging"}},
+		{[]string{"apply"}, "-a", []string{"-auto-approve", "prod", "staging"}},
+		{[]string{"state"}, "", []string{"list"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(append(tc.Completed, tc.Last), " "), func(t *testing.T) {
+			called := make(map[string]bool)
+			cli := testSpecCLI(called)
+			cli.Autocomplete = true
+
+			// We need to initialize the autocomplete environment so that
+			// the cli doesn't no-op the autocomplete init
+			defer testAutocomplete(t, "must be non-empty")()
+
+			// Initialize
+			cli.init()
+
+			lastCompleted := ""
+			if len(tc.Completed) > 0 {
+				lastCompleted = tc.Completed[len(tc.Completed)-1]
+			}
+
+			actual := cli.autocomplete.Command.Predict(complete.Args{
+				Completed:     tc.Completed,
+				Last:          tc.Last,
+				LastCompleted: lastCompleted,
+			})
+			sort.Strings(actual)
+
+			if !reflect.DeepEqual(actual, tc.Expected) {
+				t.Fatalf("bad prediction: %#v", actual)
+			}
+
+			if !reflect.DeepEqual(called, map[string]bool{"plain": true}) {
+				t.Fatalf("bad: %#v", called)
+			}
+		})
+	}
+}
+
+func TestCLIRun_specComplete(t *testing.T) {
+	called := make(map[string]bool)
+	buf := new(bytes.Buffer)
+	cli := testSpecCLI(called)
+	cli.Args = []string{"__complete", "a"}
+	cli.Autocomplete = true
+	cli.autocompleteWriter = buf
+
+	code, err := cli.Run()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if code != 0 {
+		t.Fatalf("bad: %d", code)
+	}
+
+	expected := "apply\tApply the changes\n:1\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	if called["apply"] {
+		t.Fatal("factory should not be called")
+	}
+}
+
+func TestCLIRun_specCompleteCommand(t *testing.T) {
+	cases := []struct {
+		Args     []string
+		Expected string
+	}{
+		{[]string{"apply", "-"}, "-auto-approve\n:1\n"},
+		{[]string{"apply", "s"}, "staging\n:0\n"},
+		{[]string{"state", "list", "-"}, ":1\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(strings.Join(tc.Args, " "), func(t *testing.T) {
+			called := make(map[string]bool)
+			buf := new(bytes.Buffer)
+			cli := testSpecCLI(called)
+			cli.Args = append([]string{"__complete"}, tc.Args...)
+			cli.Autocomplete = true
+			cli.autocompleteWriter = buf
+
+			code, err := cli.Run()
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if code != 0 {
+				t.Fatalf("bad: %d", code)
+			}
+
+			if buf.String() != tc.Expected {
+				t.Fatalf("bad: %q", buf.String())
+			}
+
+			// The commands are completed from their specs
+			if len(called) > 0 {
+				t.Fatalf("bad: %#v", called)
+			}
+		})
+	}
+}
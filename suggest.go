@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultSuggestDistance is the default maximum edit distance for a
+// command to be suggested for an unknown subcommand.
+const defaultSuggestDistance = 2
+
+// writeSuggestions writes the message suggesting the visible commands
+// underneath parent that are closest to the unknown subcommand. Nothing
+// is written if there is nothing to suggest.
+func (c *CLI) writeSuggestions(parent, unknown string) {
+	if unknown == "" || unknown[0] == '-' || c.SuggestDistance < 0 {
+		return
+	}
+
+	distance := c.SuggestDistance
+	if distance == 0 {
+		distance = defaultSuggestDistance
+	}
+
+	// helpCommands already filters out hidden commands so we only
+	// suggest commands that the user could have found on their own.
+	var names []string
+	for k := range c.helpCommands(parent, false) {
+		if idx := strings.LastIndex(k, " "); idx > -1 {
+			k = k[idx+1:]
+		}
+
+		names = append(names, k)
+	}
+
+	suggestions := suggestCommands(unknown, names, distance)
+	if len(suggestions) == 0 {
+		return
+	}
+
+	f := c.SuggestFunc
+	if f == nil {
+		f = defaultSuggestFunc
+	}
+
+	if msg := f(unknown, suggestions); msg != "" {
+		c.ErrorWriter.Write([]byte(msg + "\n\n"))
+	}
+}
+
+// defaultSuggestFunc is the SuggestFunc used if none is given.
+func defaultSuggestFunc(unknown string, suggestions []string) string {
+	if len(suggestions) == 1 {
+		return fmt.Sprintf("Unknown command '%s'. Did you mean '%s'?",
+			unknown, suggestions[0])
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf(
+		"Unknown command '%s'. Did you mean one of these?", unknown))
+	for _, s := range suggestions {
+		buf.WriteString("\n    " + s)
+	}
+
+	return buf.String()
+}
+
+// suggestCommands returns the names that are either within the given edit
+// distance of the unknown name or that start with it. The comparison is
+// case-insensitive and the result is ordered from closest to furthest.
+func suggestCommands(unknown string, names []string, distance int) []string {
+	unknown = strings.ToLower(unknown)
+
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	var found []suggestion
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		d := levenshtein(unknown, lower)
+		if d <= distance || strings.HasPrefix(lower, unknown) {
+			found = append(found, suggestion{name: name, distance: d})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+
+		return found[i].name < found[j].name
+	})
+
+	result := make([]string, len(found))
+	for i, s := range found {
+		result[i] = s.name
+	}
+
+	return result
+}
+
+// levenshtein returns the Levenshtein distance between a and b, which is
+// the minimum number of single character insertions, deletions and
+// substitutions required to turn one into the other.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// We only ever need the previous row of the matrix to compute the
+	// current one.
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+
+	return a
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		A, B     string
+		Expected int
+	}{
+		{"", "", 0},
+		{"foo", "", 3},
+		{"", "foo", 3},
+		{"status", "status", 0},
+		{"stauts", "status", 2},
+		{"stats", "status", 1},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tc := range cases {
+		if actual := levenshtein(tc.A, tc.B); actual != tc.Expected {
+			t.Errorf("%q, %q: expected %d, got %d", tc.A, tc.B, tc.Expected, actual)
+		}
+	}
+}
+
+func TestSuggestCommands(t *testing.T) {
+	names := []string{"apply", "state", "status", "start", "version"}
+	cases := []struct {
+		Unknown  string
+		Distance int
+		Expected []string
+	}{
+		{"stauts", 1, nil},
+		{"STATUS", 2, []string{"status", "state"}},
+		{"stat", 2, []string{"start", "state", "status"}},
+		{"stat", 1, []string{"start", "state", "status"}},
+		{"aply", 2, []string{"apply"}},
+		{"ver", 1, []string{"version"}},
+		{"destroy", 2, nil},
+	}
+
+	for _, tc := range cases {
+		actual := suggestCommands(tc.Unknown, names, tc.Distance)
+		if len(actual) == 0 {
+			actual = nil
+		}
+
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Errorf("%q: expected %#v, got %#v", tc.Unknown, tc.Expected, actual)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 
 	"github.com/bgentry/speakeasy"
 	"github.com/mattn/go-isatty"
@@ -42,6 +43,104 @@ type Ui interface {
 	Warn(string)
 }
 
+// errInterrupted is returned by BasicUi when asking is interrupted.
+var errInterrupted = errors.New("interrupted")
+
+// prompts coordinates the interrupts of a BasicUi that is asking with
+// the CLI, which handles interrupts while a command runs. As long as the
+// CLI handles them, it gives an interrupt to the last prompt that is
+// waiting instead of cancelling the command, so that the interrupt only
+// aborts the prompt.
+var prompts struct {
+	sync.Mutex
+	handlers int
+	waiting  []chan os.Signal
+}
+
+// waitPromptInterrupt returns the channel of the interrupts for a prompt
+// and the function to call once the prompt is over. The prompt registers
+// for interrupts itself unless the CLI handles them.
+func waitPromptInterrupt() (<-chan os.Signal, func()) {
+	prompts.Lock()
+	defer prompts.Unlock()
+
+	ch := make(chan os.Signal, 1)
+	prompts.waiting = append(prompts.waiting, ch)
+
+	notified := prompts.handlers == 0
+	if notified {
+		signal.Notify(ch, os.Interrupt)
+	}
+
+	return ch, func() {
+		if notified {
+			signal.Stop(ch)
+		}
+
+		prompts.Lock()
+		defer prompts.Unlock()
+		for i, w := range prompts.waiting {
+			if w == ch {
+				prompts.waiting = append(prompts.waiting[:i], prompts.waiting[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// filterPromptInterrupts returns the signals from sigCh that are left
+// after giving interrupts to the prompts that are waiting, until doneCh
+// is closed, and the function to call once the CLI stops handling them.
+func filterPromptInterrupts(sigCh <-chan os.Signal, doneCh <-chan struct{}) (<-chan os.Signal, func()) {
+	prompts.Lock()
+	prompts.handlers++
+	prompts.Unlock()
+
+	out := make(chan os.Signal, cap(sigCh))
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == os.Interrupt && interruptPrompt(sig) {
+					continue
+				}
+
+				select {
+				case out <- sig:
+				case <-doneCh:
+					return
+				}
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+
+	return out, func() {
+		prompts.Lock()
+		prompts.handlers--
+		prompts.Unlock()
+	}
+}
+
+// interruptPrompt gives the interrupt to the last prompt that is waiting
+// and returns true if there is one.
+func interruptPrompt(sig os.Signal) bool {
+	prompts.Lock()
+	defer prompts.Unlock()
+
+	if len(prompts.waiting) == 0 {
+		return false
+	}
+
+	select {
+	case prompts.waiting[len(prompts.waiting)-1] <- sig:
+	default:
+	}
+
+	return true
+}
+
 // BasicUi is an implementation of Ui that just outputs to the given
 // writer. This UI is not threadsafe by default, but you can wrap it
 // in a ConcurrentUi to make it safe.
@@ -66,9 +165,8 @@ func (u *BasicUi) ask(query string, secret bool) (string, error) {
 
 	// Register for interrupts so that we can catch it and immediately
 	// return...
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt)
-	defer signal.Stop(sigCh)
+	sigCh, done := waitPromptInterrupt()
+	defer done()
 
 	// Ask for input in a go-routine so that we can ignore it.
 	errCh := make(chan error, 1)
@@ -100,7 +198,7 @@ func (u *BasicUi) ask(query string, secret bool) (string, error) {
 		// on a new line.
 		fmt.Fprintln(u.Writer)
 
-		return "", errors.New("interrupted")
+		return "", errInterrupted
 	}
 }
 
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// readBuildInfo is debug.ReadBuildInfo, which tests can replace.
+var readBuildInfo = debug.ReadBuildInfo
+
+// VersionInfo is the version of the CLI along with the metadata of the
+// build, as printed by the version flag and the version command.
+type VersionInfo struct {
+	// Name and Version are the Name and Version of the CLI.
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version"`
+
+	// Revision is the VCS revision the binary was built from and Dirty is
+	// true if there were uncommitted changes. BuildTime is the time of the
+	// revision in RFC 3339 format. These are only known if the binary was
+	// built with VCS stamping, which is the default for "go build" within
+	// a repository.
+	Revision  string `json:"revision,omitempty"`
+	Dirty     bool   `json:"dirty"`
+	BuildTime string `json:"build_time,omitempty"`
+
+	// GoVersion is the version of Go the binary was built with.
+	GoVersion string `json:"go_version"`
+
+	// Fields are the additional fields from CLI.VersionFields.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// VersionInfo returns the version of the CLI along with the metadata of
+// the build.
+func (c *CLI) VersionInfo() *VersionInfo {
+	info := &VersionInfo{
+		Name:      c.Name,
+		Version:   c.Version,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := readBuildInfo(); ok {
+		if bi.GoVersion != "" {
+			info.GoVersion = bi.GoVersion
+		}
+
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.BuildTime = s.Value
+			case "vcs.modified":
+				info.Dirty = s.Value == "true"
+			}
+		}
+	}
+
+	if len(c.VersionFields) > 0 {
+		info.Fields = make(map[string]string, len(c.VersionFields))
+		for k, v := range c.VersionFields {
+			info.Fields[k] = v
+		}
+	}
+
+	return info
+}
+
+// String returns the version information in a human readable form. The
+// first line is the name and version, followed by a line for each of the
+// other fields that are known.
+func (v *VersionInfo) String() string {
+	var buf strings.Builder
+	buf.WriteString(strings.TrimSpace(v.Name + " " + v.Version))
+	buf.WriteString("\n")
+
+	var keys, values []string
+	add := func(k, v string) {
+		if v != "" {
+			keys = append(keys, k)
+			values = append(values, v)
+		}
+	}
+
+	revision := v.Revision
+	if revision != "" && v.Dirty {
+		revision += " (dirty)"
+	}
+	add("Revision", revision)
+	add("Build time", v.BuildTime)
+	add("Go version", v.GoVersion)
+
+	fields := make([]string, 0, len(v.Fields))
+	for k := range v.Fields {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for _, k := range fields {
+		add(k, v.Fields[k])
+	}
+
+	maxLen := 0
+	for _, k := range keys {
+		if len(k) > maxLen {
+			maxLen = len(k)
+		}
+	}
+
+	for i, k := range keys {
+		buf.WriteString(fmt.Sprintf("%s:%s %s\n", k, strings.Repeat(" ", maxLen-len(k)), values[i]))
+	}
+
+	return buf.String()
+}
+
+// JSON returns the version information as indented JSON.
+func (v *VersionInfo) JSON() string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		// This can't happen since all the fields are strings and bools
+		panic(err)
+	}
+
+	return string(data) + "\n"
+}
+
+// writeVersion writes the version to HelpWriter, as JSON if json is true.
+func (c *CLI) writeVersion(json bool) {
+	info := c.VersionInfo()
+	if json {
+		c.HelpWriter.Write([]byte(info.JSON()))
+		return
+	}
+
+	c.HelpWriter.Write([]byte(info.String()))
+}
+
+// VersionCommandFactory returns a factory for a "version" command that
+// prints the version like the version flag does, including the "-json"
+// flag. For example:
+//
+//	c.Commands["version"] = c.VersionCommandFactory()
+func (c *CLI) VersionCommandFactory() CommandFactory {
+	return func() (Command, error) {
+		return &versionCommand{cli: c}, nil
+	}
+}
+
+// versionCommand is the command returned by CLI.VersionCommandFactory.
+type versionCommand struct {
+	cli  *CLI
+	json bool
+}
+
+func (v *versionCommand) Flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.BoolVar(&v.json, "json", false, "Print the version as JSON.")
+	return fs
+}
+
+func (v *versionCommand) Help() string {
+	name := v.cli.Name
+	if name == "" {
+		name = "app"
+	}
+
+	return strings.TrimSpace(fmt.Sprintf(`
+Usage: %s version [-json]
+
+  Prints the version of %s and how it was built.
+`, name, name))
+}
+
+func (v *versionCommand) Run(args []string) int {
+	v.cli.writeVersion(v.json)
+	return 0
+}
+
+func (v *versionCommand) Synopsis() string {
+	return "Prints the version"
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"runtime/debug"
+	"testing"
+)
+
+func testBuildInfo(t *testing.T) {
+	old := readBuildInfo
+	t.Cleanup(func() { readBuildInfo = old })
+
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			GoVersion: "go1.99.1",
+			Settings: []debug.BuildSetting{
+				{Key: "vcs", Value: "git"},
+				{Key: "vcs.revision", Value: "0123456789abcdef"},
+				{Key: "vcs.time", Value: "2026-10-17T12:00:00Z"},
+				{Key: "vcs.modified", Value: "true"},
+			},
+		}, true
+	}
+}
+
+func TestCLIVersionInfo(t *testing.T) {
+	testBuildInfo(t)
+
+	cli := &CLI{
+		Name:          "app",
+		Version:       "1.0.0",
+		VersionFields: map[string]string{"Plugin protocol": "5"},
+	}
+
+	expected := &VersionInfo{
+		Name:      "app",
+		Version:   "1.0.0",
+		Revision:  "0123456789abcdef",
+		Dirty:     true,
+		BuildTime: "2026-10-17T12:00:00Z",
+		GoVersion: "go1.99.1",
+		Fields:    map[string]string{"Plugin protocol": "5"},
+	}
+
+	actual := cli.VersionInfo()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestVersionInfoString(t *testing.T) {
+	cases := []struct {
+		Info     *VersionInfo
+		Expected string
+	}{
+		{
+			&VersionInfo{Version: "1.0.0", GoVersion: "go1.99.1"},
+			"1.0.0\nGo version: go1.99.1\n",
+		},
+		{
+			&VersionInfo{
+				Name:      "app",
+				Version:   "1.0.0",
+				Revision:  "abc",
+				Dirty:     true,
+				BuildTime: "2026-10-17T12:00:00Z",
+				GoVersion: "go1.99.1",
+				Fields:    map[string]string{"Plugin protocol": "5", "API": "v2"},
+			},
+			"app 1.0.0\n" +
+				"Revision:        abc (dirty)\n" +
+				"Build time:      2026-10-17T12:00:00Z\n" +
+				"Go version:      go1.99.1\n" +
+				"API:             v2\n" +
+				"Plugin protocol: 5\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Info.Version, func(t *testing.T) {
+			if actual := tc.Info.String(); actual != tc.Expected {
+				t.Fatalf("bad: %q", actual)
+			}
+		})
+	}
+}
+
+func TestCLIRun_version(t *testing.T) {
+	testBuildInfo(t)
+
+	cases := []struct {
+		Args    []string
+		Default bool
+		JSON    bool
+	}{
+		{[]string{"-v"}, false, false},
+		{[]string{"--version"}, false, false},
+		{[]string{"-version", "-json"}, false, true},
+		{[]string{"--json", "-v"}, false, true},
+		{[]string{"version"}, false, false},
+		{[]string{"version", "-json"}, false, true},
+		{[]string{"-v"}, true, false},
+		{[]string{"-version", "-json"}, true, true},
+		{[]string{"--json", "-v"}, true, true},
+	}
+
+	for _, tc := range cases {
+		buf := new(bytes.Buffer)
+		cli := &CLI{
+			Args:    tc.Args,
+			Name:    "app",
+			Version: "1.0.0",
+			Commands: map[string]CommandFactory{
+				"foo": func() (Command, error) {
+					return new(MockCommand), nil
+				},
+			},
+			HelpWriter: buf,
+		}
+		cli.Commands["version"] = cli.VersionCommandFactory()
+		if tc.Default {
+			cli.Commands[""] = func() (Command, error) {
+				return new(MockCommand), nil
+			}
+		}
+
+		exitCode, err := cli.Run()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if exitCode != 0 {
+			t.Fatalf("Args: %#v. Code: %d", tc.Args, exitCode)
+		}
+
+		if !tc.JSON {
+			if buf.String() != cli.VersionInfo().String() {
+				t.Fatalf("Args: %#v. bad: %q", tc.Args, buf.String())
+			}
+
+			continue
+		}
+
+		var info VersionInfo
+		if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+			t.Fatalf("Args: %#v. err: %s", tc.Args, err)
+		}
+
+		if !reflect.DeepEqual(&info, cli.VersionInfo()) {
+			t.Fatalf("Args: %#v. bad: %q", tc.Args, buf.String())
+		}
+	}
+}